@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/PopescuStefanRadu/ent-demo/pkg/external/dog/dogtest"
+	"github.com/rs/zerolog"
+)
+
+const (
+	readHeaderTimout = 15 * time.Second
+	shutdownTimeout  = 5 * time.Second
+)
+
+const usage = `Usage: dogstub [flags]
+
+Serves /woof.json (random.dog) and /api/breeds/image/random (dog.ceo) for local runs, e.g.:
+
+  go run ./cmd/dogstub -addr :8081 -latency 200ms -error-rate 0.2
+  PHOTO_BASE_URL=http://localhost:8081 PHOTO_VALIDATION_ALLOWED_HOSTS= go run ./cmd/http/server
+
+Flags:
+`
+
+func main() {
+	l := zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr})
+
+	var config dogtest.Config
+
+	fs := flag.NewFlagSet("dogstub", flag.ExitOnError)
+	addr := fs.String("addr", ":8081", "address to listen on")
+	urls := fs.String("urls", strings.Join(dogtest.DefaultURLs, ","), "comma separated URLs to serve")
+	fs.DurationVar(&config.Latency, "latency", 0, "delay of every answer")
+	fs.DurationVar(&config.LatencyJitter, "jitter", 0, "maximum random delay added to -latency")
+	fs.Float64Var(&config.ErrorRate, "error-rate", 0, "fraction of the requests answered with -error-status")
+	fs.IntVar(&config.ErrorStatus, "error-status", http.StatusServiceUnavailable, "status of the failed answers")
+	fs.Float64Var(&config.MalformedRate, "malformed-rate", 0, "fraction of the requests answered with a malformed body")
+	fs.Int64Var(&config.Seed, "seed", 0, "seed of the random choices, from the clock if 0")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+
+	_ = fs.Parse(os.Args[1:])
+
+	config.URLs = strings.Split(*urls, ",")
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, l, *addr, config); err != nil {
+		l.Err(err).Msg("Dog stub closed with an unexpected error")
+		os.Exit(1) //nolint:gocritic // nothing left to clean up
+	}
+}
+
+func run(ctx context.Context, l zerolog.Logger, addr string, config dogtest.Config) error {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           dogtest.NewHandler(config),
+		ReadHeaderTimeout: readHeaderTimout,
+	}
+
+	serverErr := make(chan error, 1)
+
+	go func() {
+		serverErr <- srv.ListenAndServe()
+	}()
+
+	l.Info().Msgf("Dog stub listening on %s", addr)
+
+	select {
+	case err := <-serverErr:
+		return err
+	case <-ctx.Done():
+		timeout, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		if err := srv.Shutdown(timeout); err != nil && !errors.Is(err, http.ErrServerClosed) { //nolint:contextcheck
+			return err
+		}
+
+		return nil
+	}
+}
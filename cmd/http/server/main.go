@@ -2,43 +2,64 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
-	"github.com/PopescuStefanRadu/ent-demo/pkg/app"
-	"github.com/PopescuStefanRadu/ent-demo/pkg/external/dog"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/config"
 	"github.com/PopescuStefanRadu/ent-demo/pkg/http/server"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/telemetry"
 	"github.com/rs/zerolog"
-	"github.com/sony/gobreaker"
 )
 
-const shutdownTimeout = 30 * time.Second
-
 func main() {
 	l := zerolog.New(os.Stdout)
 
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+
+	cfg, opts, err := config.Load(fs, os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+
+	if err != nil {
+		l.Err(err).Msg("Could not load the configuration")
+		os.Exit(2) //nolint:gomnd
+	}
+
+	if opts.PrintConfig {
+		if err := config.Print(os.Stdout, cfg); err != nil {
+			l.Err(err).Msg("Could not print the configuration")
+			os.Exit(1)
+		}
+
+		return
+	}
+
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
 	ctx = l.WithContext(ctx)
 
-	srv, err := server.NewHTTPServer(server.Config{
-		ShutdownTimeout: shutdownTimeout,
-		Address:         ":8080",
-		AppConfig: &app.Config{
-			DBUrl:            "file:ent?mode=memory&cache=shared&_fk=1",
-			DebugPersistence: true,
-			DogClientConfig: dog.ClientConfig{
-				Enabled: true,
-				BaseURL: "https://random.dog",
-				CircuitBreakerSettings: gobreaker.Settings{
-					Name: "dog",
-				},
-			},
-		},
-	}, l)
+	shutdownTelemetry, err := telemetry.Setup(ctx, cfg.TelemetryConfig())
+	if err != nil {
+		l.Err(err).Msg("Could not set up telemetry")
+		return
+	}
+
+	defer func() {
+		timeout, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Server.ShutdownTimeout))
+		defer cancel()
+
+		if err := shutdownTelemetry(timeout); err != nil {
+			l.Err(err).Msg("Could not flush the spans")
+		}
+	}()
+
+	srv, err := server.NewHTTPServer(cfg.ServerConfig(), l)
 	if err != nil {
 		l.Err(err).Msg("Could not create http server")
 		return
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/PopescuStefanRadu/ent-demo/pkg/app"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/entwrap"
+	"github.com/rs/zerolog"
+)
+
+const usage = `Usage: migrate [flags] <command>
+
+Commands:
+  up [n]      apply the next n pending migrations, all of them by default
+  down [n]    revert the last n applied migrations, 1 by default
+  status      list the applied and pending migrations
+  new <name>  generate a migration from the changes of pkg/ent/schema; run from the repository root
+
+Flags:
+`
+
+var errUsage = errors.New("invalid usage")
+
+func main() {
+	l := zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr})
+
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dbDialect := fs.String("dialect", app.DefaultDBDialect,
+		"dialect of the databases, one of "+strings.Join(entwrap.Dialects(), ", "))
+	dsn := fs.String("dsn", "file:ent.db?_fk=1", "database to migrate")
+	devDSN := fs.String("dev-dsn", "file:dev?mode=memory&_fk=1",
+		"empty database used by new to compute the changes, of the same dialect")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+
+	_ = fs.Parse(os.Args[1:])
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, l, fs.Args(), *dbDialect, *dsn, *devDSN); err != nil {
+		if errors.Is(err, errUsage) {
+			fs.Usage()
+		}
+
+		l.Err(err).Msg("Migration command failed")
+		os.Exit(1) //nolint:gocritic // nothing left to clean up
+	}
+}
+
+func run(ctx context.Context, l zerolog.Logger, args []string, dbDialect, dsn, devDSN string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	if args[0] == "new" {
+		if len(args) != 2 { //nolint:gomnd
+			return fmt.Errorf("%w: new requires a name", errUsage)
+		}
+
+		return entwrap.NewMigration(ctx, dbDialect, devDSN, args[1])
+	}
+
+	db, err := entwrap.OpenDB(dbDialect, dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	dir, err := entwrap.MigrationsDir(dbDialect)
+	if err != nil {
+		return err
+	}
+
+	migrator := entwrap.Migrator{DB: db, Dialect: dbDialect, Dir: dir, Logger: l}
+
+	switch args[0] {
+	case "up":
+		n, err := count(args, 0)
+		if err != nil {
+			return err
+		}
+
+		_, err = migrator.Up(ctx, n)
+
+		return err
+	case "down":
+		n, err := count(args, 1)
+		if err != nil {
+			return err
+		}
+
+		_, err = migrator.Down(ctx, n)
+
+		return err
+	case "status":
+		return printStatus(ctx, migrator)
+	default:
+		return fmt.Errorf("%w: unknown command %q", errUsage, args[0])
+	}
+}
+
+func count(args []string, def int) (int, error) {
+	if len(args) < 2 { //nolint:gomnd
+		return def, nil
+	}
+
+	n, err := strconv.Atoi(args[1])
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("%w: %q is not a positive number", errUsage, args[1])
+	}
+
+	return n, nil
+}
+
+func printStatus(ctx context.Context, migrator entwrap.Migrator) error {
+	status, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Current version: %q\n", status.Current())
+
+	for _, m := range status.Applied {
+		fmt.Printf("applied  %s_%s\n", m.Version, m.Name)
+	}
+
+	for _, m := range status.Pending {
+		fmt.Printf("pending  %s_%s\n", m.Version, m.Name)
+	}
+
+	for _, version := range status.Unknown {
+		fmt.Printf("unknown  %s\n", version)
+	}
+
+	return nil
+}
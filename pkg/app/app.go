@@ -4,79 +4,171 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"os"
+	"sync"
 	"testing"
 
+	"entgo.io/ent/dialect"
 	entsql "entgo.io/ent/dialect/sql"
 	"github.com/PopescuStefanRadu/ent-demo/pkg/ent"
 	"github.com/PopescuStefanRadu/ent-demo/pkg/entwrap"
 	"github.com/PopescuStefanRadu/ent-demo/pkg/external/dog"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/external/photo"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/requestid"
 	"github.com/PopescuStefanRadu/ent-demo/pkg/user"
 	mockUser "github.com/PopescuStefanRadu/ent-demo/pkg/user/mock"
-	_ "github.com/mattn/go-sqlite3" // importing drivers because it's easier to have a shared initialization for the application based on the config
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
 )
 
-const DBDriverName = "sqlite3"
+// DefaultDBDialect is used when Config.DBDialect is not set.
+const DefaultDBDialect = dialect.SQLite
+
+// Environment variables that select the database of the tests, see TestDBConfig.
+const (
+	TestDBDialectEnv = "TEST_DB_DIALECT"
+	TestDBUrlEnv     = "TEST_DB_URL"
+)
 
 type Config struct {
+	// DBDialect is one of entwrap.Dialects.
+	DBDialect        string
 	DBUrl            string
 	DebugPersistence bool
-	DogClientConfig  dog.ClientConfig
+	// MigrateOnStart applies the pending migrations in Init. Otherwise, migrations are applied with cmd/migrate and
+	// Init only checks that they were.
+	MigrateOnStart bool
+	// PhotoProvider selects where the photos of the users come from, see photo.Types.
+	PhotoProvider photo.ProviderConfig
+	// Prefetch keeps a pool of photo URLs filled in the background, so that requests do not wait for the provider.
+	Prefetch   dog.PrefetchConfig
+	Enrichment user.EnrichmentConfig
 }
 
 type App struct {
-	Logger   zerolog.Logger
-	Migrator Migrator
+	Logger         zerolog.Logger
+	Migrator       Migrator
+	MigrateOnStart bool
+	// Workers run in the background between Start and the call of the stop function it returns.
+	Workers []Worker
 	*user.Service
 }
 
+// Worker is a background task of the App.
+type Worker interface {
+	// Run works until ctx is canceled.
+	Run(ctx context.Context)
+}
+
 type Mocks struct {
 	DogClient *mockUser.MockDog
 }
 
 type Migrator interface {
+	// Migrate applies the pending migrations.
 	Migrate(ctx context.Context) error
+	// CheckVersion fails unless all the migrations known to the application were applied.
+	CheckVersion(ctx context.Context) error
 }
 
 func NewAppFromConfig(l zerolog.Logger, cfg *Config) (*App, error) {
-	sqlDB, err := sql.Open(DBDriverName, cfg.DBUrl)
-	if err != nil {
-		return nil, fmt.Errorf("could not open db: %w", err)
+	dbDialect := cfg.DBDialect
+	if dbDialect == "" {
+		dbDialect = DefaultDBDialect
 	}
 
-	drv := entsql.OpenDB(DBDriverName, sqlDB)
+	sqlDB, err := entwrap.OpenDB(dbDialect, cfg.DBUrl)
+	if err != nil {
+		return nil, err
+	}
 
-	opts := []ent.Option{ent.Driver(drv)}
+	var drv dialect.Driver = entwrap.NewMetricsDriver(entwrap.NewTracingDriver(entsql.OpenDB(dbDialect, sqlDB)))
 	if cfg.DebugPersistence {
-		opts = append(opts, ent.Log(func(a ...any) {
-			l.Info().Msgf("ent: %s", fmt.Sprint(a))
-		}))
+		drv = dialect.DebugWithContext(drv, queryLogger(l))
 	}
 
-	EntClient := ent.NewClient(opts...)
+	EntClient := ent.NewClient(ent.Driver(drv))
+
+	migrationsDir, err := entwrap.MigrationsDir(dbDialect)
+	if err != nil {
+		return nil, err
+	}
 
 	userRepository := &entwrap.UserRepository{Client: EntClient.User}
-	dogClient := dog.NewClient(cfg.DogClientConfig)
-	userService := &user.Service{UserRepository: userRepository, DogClient: dogClient}
+	unitOfWork := &entwrap.UnitOfWork{Client: EntClient}
+	dogClient, err := photo.New(cfg.PhotoProvider)
+	if err != nil {
+		return nil, err
+	}
+
+	var workers []Worker
+
+	if cfg.Prefetch.Size > 0 {
+		pool := dog.NewPrefetchPool(dogClient, cfg.Prefetch)
+		dogClient = pool
+		workers = append(workers, pool)
+	}
+
+	userService := &user.Service{
+		UserRepository: userRepository,
+		UnitOfWork:     unitOfWork,
+		DogClient:      dogClient,
+		Enrichment:     cfg.Enrichment,
+	}
 
 	return &App{
-		Logger:   l,
-		Migrator: entwrap.Migrator{Ent: EntClient, Logger: l},
-		Service:  userService,
+		Logger:         l,
+		Migrator:       entwrap.Migrator{DB: sqlDB, Dialect: dbDialect, Dir: migrationsDir, Logger: l},
+		MigrateOnStart: cfg.MigrateOnStart,
+		Workers:        workers,
+		Service:        userService,
 	}, nil
 }
 
 func (a App) Init(ctx context.Context) error {
-	a.Logger.Info().Msg("Migrating")
+	if a.MigrateOnStart {
+		a.Logger.Info().Msg("Migrating")
+
+		if err := a.Migrator.Migrate(ctx); err != nil {
+			return err
+		}
 
-	err := a.Migrator.Migrate(ctx)
-	if err == nil {
 		a.Logger.Info().Msg("Migration complete")
 	}
 
-	return err
+	return a.Migrator.CheckVersion(ctx)
+}
+
+// queryLogger logs the queries of ent, with the ID of the request that made them, see requestid.
+func queryLogger(l zerolog.Logger) func(context.Context, ...any) {
+	return func(ctx context.Context, a ...any) {
+		ql := requestid.Logger(ctx, l)
+		ql.Info().Msgf("ent: %s", fmt.Sprint(a...))
+	}
+}
+
+// Start runs the Workers in the background. The returned function stops them and waits for them to return.
+func (a App) Start(ctx context.Context) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	var wg sync.WaitGroup
+
+	for _, w := range a.Workers {
+		wCpy := w
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			wCpy.Run(ctx)
+		}()
+	}
+
+	return func() {
+		cancel()
+		wg.Wait()
+	}
 }
 
 func (a App) Cleanup(ctx context.Context) error {
@@ -92,6 +184,26 @@ func (a App) Cleanup(ctx context.Context) error {
 	return nil
 }
 
+// TestDBConfig returns the dialect and url of the database that the tests run against, read from TestDBDialectEnv and
+// TestDBUrlEnv. It defaults to a shared in-memory SQLite database.
+func TestDBConfig() (dbDialect, url string) {
+	dbDialect, url = os.Getenv(TestDBDialectEnv), os.Getenv(TestDBUrlEnv)
+	if dbDialect == "" {
+		dbDialect = DefaultDBDialect
+	}
+
+	if url == "" && dbDialect == dialect.SQLite {
+		url = "file:ent?mode=memory&cache=shared&_fk=1"
+	}
+
+	return dbDialect, url
+}
+
+// OpenTestDB opens the database described by TestDBConfig.
+func OpenTestDB() (*sql.DB, error) {
+	return entwrap.OpenDB(TestDBConfig())
+}
+
 func InitTest(t *testing.T, db *sql.DB) (*require.Assertions, zerolog.Logger, context.Context, *App, Mocks) {
 	t.Helper()
 	r := require.New(t)
@@ -111,18 +223,24 @@ func InitTest(t *testing.T, db *sql.DB) (*require.Assertions, zerolog.Logger, co
 func initApp(ctx context.Context, t *testing.T, l zerolog.Logger, db *sql.DB, mocks Mocks) *App {
 	t.Helper()
 
-	drv := entsql.OpenDB("sqlite3", db)
-	EntClient := ent.NewClient(ent.Driver(drv), ent.Log(func(a ...any) {
-		l.Info().Msgf("ent: %s", fmt.Sprint(a))
-	}), ent.Debug())
+	dbDialect, _ := TestDBConfig()
+
+	drv := dialect.DebugWithContext(
+		entwrap.NewMetricsDriver(entwrap.NewTracingDriver(entsql.OpenDB(dbDialect, db))), queryLogger(l))
+	EntClient := ent.NewClient(ent.Driver(drv))
 
 	userRepository := &entwrap.UserRepository{Client: EntClient.User}
-	userService := &user.Service{UserRepository: userRepository, DogClient: mocks.DogClient}
+	unitOfWork := &entwrap.UnitOfWork{Client: EntClient}
+	userService := &user.Service{UserRepository: userRepository, UnitOfWork: unitOfWork, DogClient: mocks.DogClient}
+
+	migrationsDir, err := entwrap.MigrationsDir(dbDialect)
+	require.NoError(t, err)
 
 	app := &App{
-		Logger:   l,
-		Migrator: entwrap.Migrator{Ent: EntClient, Logger: l},
-		Service:  userService,
+		Logger:         l,
+		Migrator:       entwrap.Migrator{DB: db, Dialect: dbDialect, Dir: migrationsDir, Logger: l},
+		MigrateOnStart: true,
+		Service:        userService,
 	}
 
 	require.NoError(t, app.Init(ctx))
@@ -1,14 +1,30 @@
 package app_test
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"testing/fstest"
 	"time"
 
+	atlasmigrate "ariga.io/atlas/sql/migrate"
+	"entgo.io/ent/dialect"
 	"github.com/PopescuStefanRadu/ent-demo/pkg/app"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/auth"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/entwrap"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/external/dog"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/external/photo"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/requestid"
 	"github.com/PopescuStefanRadu/ent-demo/pkg/user"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
 )
@@ -17,7 +33,7 @@ var SqlDB *sql.DB //nolint:golint,revive,stylecheck
 
 func TestMain(m *testing.M) {
 	var err error
-	SqlDB, err = sql.Open("sqlite3", "file:ent?mode=memory&cache=shared&_fk=1")
+	SqlDB, err = app.OpenTestDB()
 	if err != nil {
 		panic(err.Error())
 	}
@@ -32,7 +48,7 @@ func TestCreateUser(t *testing.T) {
 
 	mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org", nil).Times(1)
 
-	createdUser, err := app.CreateUser(ctx, &user.CreateUserParams{
+	createdUser, _, err := app.CreateUser(ctx, &user.CreateUserParams{
 		Username: "testUser",
 		Email:    "testUser@mail.example",
 	})
@@ -48,9 +64,9 @@ func TestCreateUser(t *testing.T) {
 func TestGetUserById(t *testing.T) {
 	r, _, ctx, app, mocks := app.InitTest(t, SqlDB)
 
-	mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org", nil).Times(2)
+	mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org", nil).Times(1)
 
-	createdUser, err := app.CreateUser(ctx, &user.CreateUserParams{
+	createdUser, _, err := app.CreateUser(ctx, &user.CreateUserParams{
 		Username: "testUser",
 		Email:    "testUser@mail.example",
 	})
@@ -67,15 +83,43 @@ func TestGetUserById(t *testing.T) {
 		DogPhotoURL: "https://example.org",
 		CreatedAt:   createdUser.CreatedAt,
 		UpdatedAt:   createdUser.UpdatedAt,
+		Version:     1,
 	}, createdUser)
 }
 
-func TestUpdateUser(t *testing.T) {
+func TestGetUserByIdNotFound(t *testing.T) {
+	r, _, ctx, app, _ := app.InitTest(t, SqlDB)
+
+	_, err := app.GetUserByID(ctx, 4242)
+
+	r.ErrorIs(err, user.ErrNotFound)
+}
+
+func TestCreateUserDuplicateEmail(t *testing.T) {
 	r, _, ctx, app, mocks := app.InitTest(t, SqlDB)
 
 	mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org", nil).Times(2)
 
-	createdUser, err := app.CreateUser(ctx, &user.CreateUserParams{
+	_, _, err := app.CreateUser(ctx, &user.CreateUserParams{
+		Username: "testUser",
+		Email:    "testUser@mail.example",
+	})
+	r.NoError(err)
+
+	_, _, err = app.CreateUser(ctx, &user.CreateUserParams{
+		Username: "testUser2",
+		Email:    "testUser@mail.example",
+	})
+	r.ErrorIs(err, user.ErrConflict)
+	r.ErrorIs(err, user.ErrEmailTaken)
+}
+
+func TestUpdateUser(t *testing.T) {
+	r, _, ctx, app, mocks := app.InitTest(t, SqlDB)
+
+	mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org", nil).Times(1)
+
+	createdUser, _, err := app.CreateUser(ctx, &user.CreateUserParams{
 		Username: "testUser",
 		Email:    "testUser@mail.example",
 	})
@@ -84,8 +128,8 @@ func TestUpdateUser(t *testing.T) {
 
 	updatedUser, err := app.UpdateUser(ctx, &user.UpdateUserParams{
 		ID:       createdUser.ID,
-		Username: "testUser2",
-		Email:    "testUser2@mail.example",
+		Username: ToPtr("testUser2"),
+		Email:    ToPtr("testUser2@mail.example"),
 	})
 	r.NoError(err)
 
@@ -93,23 +137,81 @@ func TestUpdateUser(t *testing.T) {
 	r.Equal("testUser2", updatedUser.Username)
 	r.Equal("testUser2@mail.example", updatedUser.Email)
 	r.Equal(createdUser.CreatedAt, updatedUser.CreatedAt)
-	r.Equal(createdUser.DogPhotoURL, updatedUser.DogPhotoURL)
+	r.Equal("https://example.org", updatedUser.DogPhotoURL)
 	r.LessOrEqual(createdUser.UpdatedAt, updatedUser.UpdatedAt)
+	r.Equal(createdUser.Version+1, updatedUser.Version)
+}
+
+func TestUpdateUserPartially(t *testing.T) {
+	r, _, ctx, app, mocks := app.InitTest(t, SqlDB)
+
+	mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org", nil).Times(1)
+
+	createdUser, _, err := app.CreateUser(ctx, &user.CreateUserParams{
+		Username: "testUser",
+		Email:    "testUser@mail.example",
+	})
+	r.NoError(err)
+
+	updatedUser, err := app.UpdateUser(ctx, &user.UpdateUserParams{
+		ID:    createdUser.ID,
+		Email: ToPtr("testUser2@mail.example"),
+	})
+	r.NoError(err)
+
+	r.Equal("testUser", updatedUser.Username)
+	r.Equal("testUser2@mail.example", updatedUser.Email)
+}
+
+func TestUpdateUserVersionMismatch(t *testing.T) {
+	r, _, ctx, app, mocks := app.InitTest(t, SqlDB)
+
+	mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org", nil).Times(1)
+
+	createdUser, _, err := app.CreateUser(ctx, &user.CreateUserParams{
+		Username: "testUser",
+		Email:    "testUser@mail.example",
+	})
+	r.NoError(err)
+
+	_, err = app.UpdateUser(ctx, &user.UpdateUserParams{
+		ID:       createdUser.ID,
+		Username: ToPtr("testUser2"),
+		Email:    ToPtr("testUser2@mail.example"),
+		Version:  createdUser.Version,
+	})
+	r.NoError(err)
+
+	_, err = app.UpdateUser(ctx, &user.UpdateUserParams{
+		ID:       createdUser.ID,
+		Username: ToPtr("testUser3"),
+		Email:    ToPtr("testUser3@mail.example"),
+		Version:  createdUser.Version,
+	})
+	r.ErrorIs(err, user.ErrVersionMismatch)
+
+	_, err = app.UpdateUser(ctx, &user.UpdateUserParams{
+		ID:       4242,
+		Username: ToPtr("testUser3"),
+		Email:    ToPtr("testUser3@mail.example"),
+		Version:  createdUser.Version,
+	})
+	r.ErrorIs(err, user.ErrNotFound)
 }
 
 func TestDeleteUser(t *testing.T) {
 	r, _, ctx, app, mocks := app.InitTest(t, SqlDB)
 
-	mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org", nil).Times(3)
+	mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org", nil).Times(2)
 
-	createdUser, err := app.CreateUser(ctx, &user.CreateUserParams{
+	createdUser, _, err := app.CreateUser(ctx, &user.CreateUserParams{
 		Username: "testUser",
 		Email:    "testUser@mail.example",
 	})
 	r.NoError(err)
 	r.NotNil(createdUser)
 
-	createdUser2, err := app.CreateUser(ctx, &user.CreateUserParams{
+	createdUser2, _, err := app.CreateUser(ctx, &user.CreateUserParams{
 		Username: "testUser2",
 		Email:    "testUser2@mail.example",
 	})
@@ -128,13 +230,14 @@ func TestDeleteUser(t *testing.T) {
 		DogPhotoURL: "https://example.org",
 		CreatedAt:   createdUser2.CreatedAt,
 		UpdatedAt:   createdUser2.UpdatedAt,
-	}}, allUsers)
+		Version:     1,
+	}}, allUsers.Users)
 }
 
 func TestGetUsersByIds(t *testing.T) {
 	r, _, ctx, app, mocks := app.InitTest(t, SqlDB)
 
-	mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org", nil).Times(5)
+	mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org", nil).Times(3)
 
 	usersToCreate := []*user.CreateUserParams{
 		ToPtr(user.CreateUserParams{
@@ -153,7 +256,7 @@ func TestGetUsersByIds(t *testing.T) {
 
 	expectedUsers := make([]user.User, len(usersToCreate))
 	for i, u := range usersToCreate {
-		createdUser, err := app.CreateUser(ctx, u)
+		createdUser, _, err := app.CreateUser(ctx, u)
 		r.NoError(err)
 		r.NotNil(createdUser)
 		expectedUsers[i] = *createdUser
@@ -163,10 +266,637 @@ func TestGetUsersByIds(t *testing.T) {
 	actualUsers, err := app.FindAllUsersByFilter(ctx, filter)
 
 	r.NoError(err)
-	r.Equal(expectedUsers[0:2], actualUsers)
+	r.Equal(expectedUsers[0:2], actualUsers.Users)
+}
+
+func TestFindAllUsersByFilterPaginated(t *testing.T) {
+	r, _, ctx, app, mocks := app.InitTest(t, SqlDB)
+
+	mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org", nil).Times(3)
+
+	expectedUsers := make([]user.User, 3)
+
+	for i := range expectedUsers {
+		createdUser, _, err := app.CreateUser(ctx, &user.CreateUserParams{
+			Username: fmt.Sprintf("testUser%d", i),
+			Email:    fmt.Sprintf("testUser%d@mail.example", i),
+		})
+		r.NoError(err)
+
+		expectedUsers[i] = *createdUser
+	}
+
+	firstPage, err := app.FindAllUsersByFilter(ctx, &user.FindAllFilter{Limit: 2})
+	r.NoError(err)
+	r.Equal(expectedUsers[0:2], firstPage.Users)
+	r.NotEmpty(firstPage.NextCursor)
+
+	secondPage, err := app.FindAllUsersByFilter(ctx, &user.FindAllFilter{Limit: 2, After: firstPage.NextCursor})
+	r.NoError(err)
+	r.Equal(expectedUsers[2:], secondPage.Users)
+	r.Empty(secondPage.NextCursor)
+
+	_, err = app.FindAllUsersByFilter(ctx, &user.FindAllFilter{After: "not a cursor"})
+	r.ErrorIs(err, user.ErrInvalidInput)
 }
 
 func ToPtr[T any](t T) *T {
 	p := &t
 	return p
 }
+
+//nolint:funlen
+func TestFindAllUsersByFilterCriteriaAndSort(t *testing.T) {
+	r, _, ctx, app, mocks := app.InitTest(t, SqlDB)
+
+	mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org", nil).AnyTimes()
+
+	usersToCreate := []user.CreateUserParams{
+		{Username: "alice", Email: "alice@a.example"},
+		{Username: "albert", Email: "albert@b.example"},
+		{Username: "bob", Email: "bob@a.example"},
+		{Username: "alfred", Email: "alfred@a.example"},
+	}
+
+	created := make(map[string]user.User, len(usersToCreate))
+
+	for _, u := range usersToCreate {
+		createdUser, _, err := app.CreateUser(ctx, ToPtr(u))
+		r.NoError(err)
+
+		created[u.Username] = *createdUser
+	}
+
+	usernames := func(users []user.User) []string {
+		res := make([]string, len(users))
+		for i, u := range users {
+			res[i] = u.Username
+		}
+
+		return res
+	}
+
+	byUsername, err := app.FindAllUsersByFilter(ctx, &user.FindAllFilter{Username: "bob"})
+	r.NoError(err)
+	r.Equal([]string{"bob"}, usernames(byUsername.Users))
+
+	byPrefixAndDomain, err := app.FindAllUsersByFilter(ctx, &user.FindAllFilter{
+		UsernamePrefix: "al",
+		EmailDomain:    "a.example",
+		Sort:           []user.SortKey{{Field: user.SortByUsername}},
+	})
+	r.NoError(err)
+	r.Equal([]string{"alfred", "alice"}, usernames(byPrefixAndDomain.Users))
+
+	byCreatedAt, err := app.FindAllUsersByFilter(ctx, &user.FindAllFilter{
+		CreatedAt: user.TimeRange{From: ToPtr(created["albert"].CreatedAt), To: ToPtr(created["alfred"].CreatedAt)},
+	})
+	r.NoError(err)
+	r.Equal([]string{"albert", "bob"}, usernames(byCreatedAt.Users))
+
+	// the bounds are compared in UTC, whatever their zone.
+	zone := time.FixedZone("UTC+14", 14*60*60)
+	byCreatedAtInZone, err := app.FindAllUsersByFilter(ctx, &user.FindAllFilter{
+		CreatedAt: user.TimeRange{
+			From: ToPtr(created["albert"].CreatedAt.In(zone)),
+			To:   ToPtr(created["alfred"].CreatedAt.In(zone)),
+		},
+	})
+	r.NoError(err)
+	r.Equal([]string{"albert", "bob"}, usernames(byCreatedAtInZone.Users))
+
+	sort := []user.SortKey{{Field: user.SortByEmail, Desc: true}, {Field: user.SortByUsername}}
+
+	var (
+		sorted []string
+		after  string
+	)
+
+	for {
+		page, err := app.FindAllUsersByFilter(ctx, &user.FindAllFilter{Sort: sort, Limit: 1, After: after})
+		r.NoError(err)
+
+		sorted = append(sorted, usernames(page.Users)...)
+
+		if page.NextCursor == "" {
+			break
+		}
+
+		after = page.NextCursor
+	}
+
+	r.Equal([]string{"bob", "alice", "alfred", "albert"}, sorted)
+
+	firstPage, err := app.FindAllUsersByFilter(ctx, &user.FindAllFilter{Sort: sort, Limit: 1})
+	r.NoError(err)
+
+	_, err = app.FindAllUsersByFilter(ctx, &user.FindAllFilter{Limit: 1, After: firstPage.NextCursor})
+	r.ErrorIs(err, user.ErrInvalidInput)
+
+	_, err = app.FindAllUsersByFilter(ctx, &user.FindAllFilter{Sort: []user.SortKey{{Field: "password"}}})
+	r.ErrorIs(err, user.ErrInvalidInput)
+}
+
+func TestRestoreAndPurgeUser(t *testing.T) {
+	r, _, ctx, app, mocks := app.InitTest(t, SqlDB)
+
+	mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org", nil).Times(1)
+
+	createdUser, _, err := app.CreateUser(ctx, &user.CreateUserParams{
+		Username: "testUser",
+		Email:    "testUser@mail.example",
+	})
+	r.NoError(err)
+
+	r.NoError(app.DeleteUserByID(ctx, createdUser.ID))
+
+	_, err = app.GetUserByID(ctx, createdUser.ID)
+	r.ErrorIs(err, user.ErrNotFound)
+
+	_, err = app.UpdateUser(ctx, &user.UpdateUserParams{ID: createdUser.ID, Username: ToPtr("updated")})
+	r.ErrorIs(err, user.ErrNotFound)
+
+	r.ErrorIs(app.DeleteUserByID(ctx, createdUser.ID), user.ErrNotFound)
+
+	restoredUser, err := app.RestoreUserByID(ctx, createdUser.ID)
+	r.NoError(err)
+	r.Equal("testUser", restoredUser.Username)
+
+	userByID, err := app.GetUserByID(ctx, createdUser.ID)
+	r.NoError(err)
+	r.Equal(restoredUser, userByID)
+
+	r.NoError(app.PurgeUserByID(ctx, createdUser.ID))
+
+	_, err = app.RestoreUserByID(ctx, createdUser.ID)
+	r.ErrorIs(err, user.ErrNotFound)
+}
+
+func TestRestoreUserNotDeleted(t *testing.T) {
+	r, _, ctx, app, mocks := app.InitTest(t, SqlDB)
+
+	mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org", nil).Times(1)
+
+	createdUser, _, err := app.CreateUser(ctx, &user.CreateUserParams{
+		Username: "testUser",
+		Email:    "testUser@mail.example",
+	})
+	r.NoError(err)
+
+	restoredUser, err := app.RestoreUserByID(ctx, createdUser.ID)
+	r.NoError(err)
+	r.Equal(createdUser.Version, restoredUser.Version)
+	r.Equal(createdUser.UpdatedAt, restoredUser.UpdatedAt)
+}
+
+func TestEmailOfDeletedUserCanBeReused(t *testing.T) {
+	if dbDialect, _ := app.TestDBConfig(); dbDialect == dialect.MySQL {
+		t.Skip("MySQL has no partial indexes, the email stays taken until the user is purged")
+	}
+
+	r, _, ctx, app, mocks := app.InitTest(t, SqlDB)
+
+	mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org", nil).Times(2)
+
+	deletedUser, _, err := app.CreateUser(ctx, &user.CreateUserParams{
+		Username: "testUser",
+		Email:    "testUser@mail.example",
+	})
+	r.NoError(err)
+	r.NoError(app.DeleteUserByID(ctx, deletedUser.ID))
+
+	_, _, err = app.CreateUser(ctx, &user.CreateUserParams{
+		Username: "testUser2",
+		Email:    "testUser@mail.example",
+	})
+	r.NoError(err)
+
+	_, err = app.RestoreUserByID(ctx, deletedUser.ID)
+	r.ErrorIs(err, user.ErrEmailTaken)
+}
+
+func TestChangesAreAudited(t *testing.T) {
+	r, _, ctx, app, mocks := app.InitTest(t, SqlDB)
+
+	var logs bytes.Buffer
+
+	ctx = zerolog.New(&logs).WithContext(auth.NewContext(ctx, &auth.Claims{Subject: "alice"}))
+
+	mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org", nil).Times(1)
+
+	createdUser, _, err := app.CreateUser(ctx, &user.CreateUserParams{
+		Username: "testUser",
+		Email:    "testUser@mail.example",
+	})
+	r.NoError(err)
+	r.NoError(app.DeleteUserByID(ctx, createdUser.ID))
+
+	// failed changes are not audited
+	r.ErrorIs(app.DeleteUserByID(ctx, createdUser.ID), user.ErrNotFound)
+
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	r.Len(lines, 2)
+
+	for i, action := range []string{user.AuditCreate, user.AuditDelete} {
+		r.Contains(lines[i], fmt.Sprintf(`"audit_action":%q`, action))
+		r.Contains(lines[i], `"audit_actor":"alice"`)
+		r.Contains(lines[i], fmt.Sprintf(`"user_id":%d`, createdUser.ID))
+	}
+}
+
+func TestRefreshDogPhoto(t *testing.T) {
+	r, _, ctx, app, mocks := app.InitTest(t, SqlDB)
+
+	gomock.InOrder(
+		mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org/1.jpg", nil),
+		mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org/2.jpg", nil),
+		mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("", user.ErrDependencyFailure),
+	)
+
+	createdUser, _, err := app.CreateUser(ctx, &user.CreateUserParams{
+		Username: "testUser",
+		Email:    "testUser@mail.example",
+	})
+	r.NoError(err)
+	r.Equal("https://example.org/1.jpg", createdUser.DogPhotoURL)
+
+	refreshedUser, err := app.RefreshDogPhoto(ctx, createdUser.ID)
+	r.NoError(err)
+	r.Equal("https://example.org/2.jpg", refreshedUser.DogPhotoURL)
+	r.Equal(createdUser.Version+1, refreshedUser.Version)
+
+	userByID, err := app.GetUserByID(ctx, createdUser.ID)
+	r.NoError(err)
+	r.Equal(refreshedUser, userByID)
+
+	_, err = app.RefreshDogPhoto(ctx, createdUser.ID)
+	r.ErrorIs(err, user.ErrDependencyFailure)
+
+	userByID, err = app.GetUserByID(ctx, createdUser.ID)
+	r.NoError(err)
+	r.Equal(refreshedUser, userByID)
+}
+
+func TestCreateUserDogFailure(t *testing.T) {
+	r, _, ctx, app, mocks := app.InitTest(t, SqlDB)
+
+	mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("", user.ErrDependencyUnavailable).Times(1)
+
+	_, _, err := app.CreateUser(ctx, &user.CreateUserParams{
+		Username: "testUser",
+		Email:    "testUser@mail.example",
+	})
+	r.ErrorIs(err, user.ErrDependencyUnavailable)
+
+	page, err := app.FindAllUsersByFilter(ctx, nil)
+	r.NoError(err)
+	r.Empty(page.Users)
+}
+
+func TestCreateUsersAllOrNothing(t *testing.T) {
+	r, _, ctx, app, mocks := app.InitTest(t, SqlDB)
+
+	mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org", nil).Times(4)
+
+	results, err := app.CreateUsers(ctx, []user.CreateUserParams{
+		{Username: "testUser", Email: "testUser@mail.example"},
+		{Username: "testUser2", Email: "testUser2@mail.example"},
+	}, user.BatchAllOrNothing)
+	r.NoError(err)
+	r.Len(results, 2)
+	r.Equal("testUser", results[0].User.Username)
+	r.Equal("testUser2", results[1].User.Username)
+	r.Equal("https://example.org", results[1].User.DogPhotoURL)
+
+	_, err = app.CreateUsers(ctx, []user.CreateUserParams{
+		{Username: "testUser3", Email: "testUser3@mail.example"},
+		{Username: "testUser4", Email: "testUser@mail.example"},
+	}, user.BatchAllOrNothing)
+	r.ErrorIs(err, user.ErrConflict)
+
+	page, err := app.FindAllUsersByFilter(ctx, &user.FindAllFilter{Username: "testUser3"})
+	r.NoError(err)
+	r.Empty(page.Users)
+}
+
+func TestCreateUsersBestEffort(t *testing.T) {
+	r, _, ctx, app, mocks := app.InitTest(t, SqlDB)
+
+	mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org", nil).Times(3)
+
+	results, err := app.CreateUsers(ctx, []user.CreateUserParams{
+		{Username: "testUser", Email: "testUser@mail.example"},
+		{Username: "testUser2", Email: "testUser@mail.example"},
+		{Username: "testUser3", Email: "testUser3@mail.example"},
+	}, user.BatchBestEffort)
+	r.NoError(err)
+	r.Len(results, 3)
+
+	r.NoError(results[0].Err)
+	r.Equal("testUser", results[0].User.Username)
+
+	r.ErrorIs(results[1].Err, user.ErrConflict)
+	r.Nil(results[1].User)
+
+	r.NoError(results[2].Err)
+	r.Equal("testUser3", results[2].User.Username)
+	r.Equal("https://example.org", results[2].User.DogPhotoURL)
+}
+
+func TestCreateUsersDegradedEnrichment(t *testing.T) {
+	r, _, ctx, app, mocks := app.InitTest(t, SqlDB)
+
+	app.Enrichment = user.EnrichmentConfig{Mode: user.EnrichDegrade}
+
+	gomock.InOrder(
+		mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("", user.ErrDependencyUnavailable),
+		mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("", user.ErrDependencyFailure),
+		mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("", user.ErrDependencyFailure),
+	)
+
+	createdUser, warning, err := app.CreateUser(ctx, &user.CreateUserParams{
+		Username: "testUser",
+		Email:    "testUser@mail.example",
+	})
+	r.NoError(err)
+	r.Empty(createdUser.DogPhotoURL)
+	r.ErrorIs(warning, user.ErrDependencyUnavailable)
+
+	for _, mode := range []user.BatchMode{user.BatchAllOrNothing, user.BatchBestEffort} {
+		results, err := app.CreateUsers(ctx, []user.CreateUserParams{
+			{Username: "testUser", Email: "testUser-" + string(mode) + "@mail.example"},
+		}, mode)
+		r.NoError(err)
+		r.Len(results, 1)
+		r.NoError(results[0].Err)
+		r.NotNil(results[0].User)
+		r.Empty(results[0].User.DogPhotoURL)
+		r.ErrorIs(results[0].Warning, user.ErrDependencyFailure)
+	}
+}
+
+func TestCreateUsersBoundedEnrichment(t *testing.T) {
+	r, _, ctx, app, mocks := app.InitTest(t, SqlDB)
+
+	app.Enrichment = user.EnrichmentConfig{Mode: user.EnrichStrict, MaxConcurrency: 2}
+
+	var running, maxRunning atomic.Int32
+
+	mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).DoAndReturn(func(context.Context) (string, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+
+		for {
+			m := maxRunning.Load()
+			if n <= m || maxRunning.CompareAndSwap(m, n) {
+				break
+			}
+		}
+
+		time.Sleep(5 * time.Millisecond)
+
+		return "https://example.org", nil
+	}).Times(10)
+
+	params := make([]user.CreateUserParams, 10)
+	for i := range params {
+		params[i] = user.CreateUserParams{Username: fmt.Sprintf("testUser%d", i), Email: fmt.Sprintf("testUser%d@mail.example", i)}
+	}
+
+	results, err := app.CreateUsers(ctx, params, user.BatchAllOrNothing)
+	r.NoError(err)
+	r.Len(results, 10)
+	r.Equal(int32(2), maxRunning.Load())
+}
+
+func TestWithinTx(t *testing.T) {
+	r, _, ctx, app, _ := app.InitTest(t, SqlDB)
+
+	errRollback := errors.New("rollback")
+
+	err := app.WithinTx(ctx, func(repo user.Repository) error {
+		_, err := repo.Create(ctx, &user.CreateUserParams{Username: "rolledBack", Email: "rolledBack@mail.example"})
+		r.NoError(err)
+
+		return errRollback
+	})
+	r.ErrorIs(err, errRollback)
+
+	r.Panics(func() {
+		_ = app.WithinTx(ctx, func(repo user.Repository) error {
+			_, err := repo.Create(ctx, &user.CreateUserParams{Username: "panicked", Email: "panicked@mail.example"})
+			r.NoError(err)
+
+			panic("rollback")
+		})
+	})
+
+	err = app.WithinTx(ctx, func(repo user.Repository) error {
+		created, err := repo.Create(ctx, &user.CreateUserParams{Username: "committed", Email: "committed@mail.example"})
+		if err != nil {
+			return err
+		}
+
+		_, err = repo.Update(ctx, &user.UpdateUserParams{ID: created.ID, Email: ToPtr("committed2@mail.example")})
+
+		return err
+	})
+	r.NoError(err)
+
+	page, err := app.UserRepository.FindAllByFilter(ctx, nil)
+	r.NoError(err)
+	r.Len(page.Users, 1)
+	r.Equal("committed", page.Users[0].Username)
+	r.Equal("committed2@mail.example", page.Users[0].Email)
+}
+
+func TestMigrations(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	l := zerolog.New(zerolog.NewTestWriter(t))
+	dbDialect, _ := app.TestDBConfig()
+
+	dir, err := entwrap.MigrationsDir(dbDialect)
+	r.NoError(err)
+
+	migrator := entwrap.Migrator{DB: SqlDB, Dialect: dbDialect, Dir: dir, Logger: l}
+
+	migrations, err := migrator.Migrations()
+	r.NoError(err)
+	r.NotEmpty(migrations)
+
+	// the database is only migrated by the other tests
+	r.NoError(migrator.Migrate(ctx))
+
+	reverted, err := migrator.Down(ctx, len(migrations))
+	r.NoError(err)
+	r.Len(reverted, len(migrations))
+	r.ErrorIs(migrator.CheckVersion(ctx), entwrap.ErrSchemaOutdated)
+
+	r.NoError(migrator.Migrate(ctx))
+	r.NoError(migrator.CheckVersion(ctx))
+
+	status, err := migrator.Status(ctx)
+	r.NoError(err)
+	r.Equal(migrations, status.Applied)
+	r.Empty(status.Pending)
+	r.Equal(migrations[len(migrations)-1].Version, status.Current())
+
+	reverted, err = migrator.Down(ctx, 1)
+	r.NoError(err)
+	r.Equal([]entwrap.Migration{migrations[len(migrations)-1]}, reverted)
+	r.ErrorIs(migrator.CheckVersion(ctx), entwrap.ErrSchemaOutdated)
+
+	applied, err := migrator.Up(ctx, 0)
+	r.NoError(err)
+	r.Equal(reverted, applied)
+	r.NoError(migrator.CheckVersion(ctx))
+
+	// a newer version of the application applied a migration that this one does not know about
+	newerDir := fstest.MapFS{
+		"99999999999999_future.up.sql":   {Data: []byte("CREATE TABLE future_migration (id INTEGER);")},
+		"99999999999999_future.down.sql": {Data: []byte("DROP TABLE future_migration;")},
+	}
+
+	for _, m := range migrations {
+		for _, suffix := range []string{".up.sql", ".down.sql"} {
+			name := m.Version + "_" + m.Name + suffix
+			data, err := fs.ReadFile(dir, name)
+			r.NoError(err)
+			newerDir[name] = &fstest.MapFile{Data: data}
+		}
+	}
+
+	writeSum(r, newerDir)
+
+	// a migration edited after it was generated is not applied
+	editedDir := fstest.MapFS{}
+	for name, file := range newerDir {
+		editedDir[name] = file
+	}
+
+	editedDir["99999999999999_future.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE edited_migration (id INTEGER);")}
+
+	_, err = entwrap.Migrator{DB: SqlDB, Dialect: dbDialect, Dir: editedDir, Logger: l}.Up(ctx, 0)
+	r.ErrorIs(err, entwrap.ErrChecksumMismatch)
+	r.ErrorContains(err, "99999999999999_future.up.sql")
+	r.NoError(migrator.CheckVersion(ctx))
+
+	newer := entwrap.Migrator{DB: SqlDB, Dialect: dbDialect, Dir: newerDir, Logger: l}
+
+	_, err = newer.Up(ctx, 0)
+	r.NoError(err)
+	r.ErrorIs(migrator.CheckVersion(ctx), entwrap.ErrUnknownMigration)
+
+	_, err = migrator.Down(ctx, 1)
+	r.ErrorIs(err, entwrap.ErrUnknownMigration)
+
+	_, err = newer.Down(ctx, 1)
+	r.NoError(err)
+	r.NoError(migrator.CheckVersion(ctx))
+}
+
+// writeSum writes the atlas.sum file of the migrations of dir, as cmd/migrate does.
+func writeSum(r *require.Assertions, dir fstest.MapFS) {
+	names, err := fs.Glob(dir, "*.sql")
+	r.NoError(err)
+
+	files := make([]atlasmigrate.File, len(names))
+	for i, name := range names {
+		files[i] = atlasmigrate.NewLocalFile(name, dir[name].Data)
+	}
+
+	sum, err := atlasmigrate.NewHashFile(files)
+	r.NoError(err)
+
+	data, err := sum.MarshalText()
+	r.NoError(err)
+
+	dir[atlasmigrate.HashFileName] = &fstest.MapFile{Data: data}
+}
+
+func TestNewAppFromConfigInvalidDB(t *testing.T) {
+	tests := []struct {
+		name      string
+		dbDialect string
+		dbURL     string
+		errIs     error
+	}{
+		{name: "unsupported dialect", dbDialect: "oracle", dbURL: "oracle://localhost"},
+		{name: "sqlite without foreign keys", dbDialect: "sqlite3", dbURL: "file:ent?mode=memory", errIs: entwrap.ErrInvalidDSN},
+		{name: "sqlite without file", dbURL: "?_fk=1", errIs: entwrap.ErrInvalidDSN},
+		{name: "malformed postgres url", dbDialect: "postgres", dbURL: "postgres://%", errIs: entwrap.ErrInvalidDSN},
+		{name: "mysql without parseTime", dbDialect: "mysql", dbURL: "user:pass@tcp(localhost:3306)/ent", errIs: entwrap.ErrInvalidDSN},
+		{name: "malformed mysql dsn", dbDialect: "mysql", dbURL: "localhost:3306", errIs: entwrap.ErrInvalidDSN},
+	}
+
+	for _, tt := range tests {
+		ttCpy := tt
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := app.NewAppFromConfig(zerolog.New(zerolog.NewTestWriter(t)), &app.Config{
+				DBDialect: ttCpy.dbDialect,
+				DBUrl:     ttCpy.dbURL,
+			})
+			require.Error(t, err)
+
+			if ttCpy.errIs != nil {
+				require.ErrorIs(t, err, ttCpy.errIs)
+			}
+		})
+	}
+}
+
+func TestStartRunsPrefetchPool(t *testing.T) {
+	r := require.New(t)
+	l := zerolog.New(zerolog.NewTestWriter(t))
+	ctx := l.WithContext(context.Background())
+
+	urls := filepath.Join(t.TempDir(), "urls.txt")
+	r.NoError(os.WriteFile(urls, []byte("https://example.org/1.jpg\n"), 0o600))
+
+	dbDialect, dbURL := app.TestDBConfig()
+	a, err := app.NewAppFromConfig(l, &app.Config{
+		DBDialect:     dbDialect,
+		DBUrl:         dbURL,
+		PhotoProvider: photo.ProviderConfig{Type: photo.TypeStatic, Static: photo.StaticConfig{File: urls}},
+		Prefetch:      dog.PrefetchConfig{Size: 3},
+	})
+	r.NoError(err)
+	r.Len(a.Workers, 1)
+
+	pool, ok := a.DogClient.(*dog.PrefetchPool)
+	r.True(ok)
+
+	stop := a.Start(ctx)
+	r.Eventually(func() bool { return pool.Stats().Len == 3 }, time.Second, time.Millisecond)
+	stop()
+
+	url, err := a.DogClient.GetRandomDogURL(ctx)
+	r.NoError(err)
+	r.Equal("https://example.org/1.jpg", url)
+	r.Equal(uint64(1), pool.Stats().Hits)
+}
+
+func TestQueryLogCarriesRequestID(t *testing.T) {
+	r := require.New(t)
+
+	var logs bytes.Buffer
+
+	dbDialect, dbURL := app.TestDBConfig()
+	a, err := app.NewAppFromConfig(zerolog.New(&logs), &app.Config{
+		DBDialect:        dbDialect,
+		DBUrl:            dbURL,
+		DebugPersistence: true,
+		MigrateOnStart:   true,
+	})
+	r.NoError(err)
+
+	ctx := requestid.NewContext(context.Background(), "abc-123")
+	r.NoError(a.Init(ctx))
+	logs.Reset()
+
+	_, err = a.GetUserByID(ctx, 1)
+	r.ErrorIs(err, user.ErrNotFound)
+	r.Contains(logs.String(), `"request_id":"abc-123"`)
+	r.Contains(logs.String(), "ent: ")
+}
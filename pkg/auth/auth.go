@@ -0,0 +1,32 @@
+// Package auth verifies the JWT bearer tokens of the callers, and carries the verified claims through the context of
+// the request, so that the handlers and services can tell who the caller is.
+package auth
+
+import (
+	"context"
+	"time"
+)
+
+// Claims are the verified claims of a token.
+type Claims struct {
+	// Subject identifies the caller.
+	Subject   string
+	Issuer    string
+	Audience  []string
+	ExpiresAt time.Time
+	// All holds every claim of the token, including the ones above and the custom ones.
+	All map[string]any
+}
+
+type ctxKey struct{}
+
+// NewContext returns a copy of ctx that carries claims.
+func NewContext(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, ctxKey{}, claims)
+}
+
+// FromContext returns the claims of the caller carried by ctx. There are none when the request was not authenticated.
+func FromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(ctxKey{}).(*Claims)
+	return claims, ok && claims != nil
+}
@@ -0,0 +1,237 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/PopescuStefanRadu/ent-demo/pkg/auth"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	issuer   = "https://issuer.example.org"
+	audience = "ent-demo"
+	secret   = "shared-secret"
+)
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":   "alice",
+		"iss":   issuer,
+		"aud":   audience,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"iat":   time.Now().Unix(),
+		"scope": "users:write",
+	}
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key any, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+
+	return signed
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// writeJWKS writes the public keys of rsaKey and ecKey, with the kids "rsa" and "ec", to a JWKS file.
+func writeJWKS(t *testing.T, rsaKey *rsa.PrivateKey, ecKey *ecdsa.PrivateKey) string {
+	t.Helper()
+
+	set := map[string]any{"keys": []map[string]string{
+		{
+			"kty": "RSA", "kid": "rsa", "use": "sig", "alg": "RS256",
+			"n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes()),
+		},
+		{
+			"kty": "EC", "kid": "ec", "crv": "P-256",
+			"x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32))),
+		},
+		{"kty": "RSA", "kid": "encryption", "use": "enc", "n": "AQAB", "e": "AQAB"},
+	}}
+
+	b, err := json.Marshal(set)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, b, 0o600))
+
+	return path
+}
+
+//nolint:funlen
+func TestVerifier(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	otherECKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	verifier, err := auth.NewVerifier(auth.Config{
+		HS256Secret: secret,
+		JWKSFile:    writeJWKS(t, rsaKey, ecKey),
+		Issuer:      issuer,
+		Audience:    audience,
+	})
+	require.NoError(t, err)
+
+	with := func(key string, value any) jwt.MapClaims {
+		claims := validClaims()
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+
+		return claims
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{name: "HS256", token: sign(t, jwt.SigningMethodHS256, "", []byte(secret), validClaims()), valid: true},
+		{name: "RS256", token: sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, validClaims()), valid: true},
+		{name: "ES256", token: sign(t, jwt.SigningMethodES256, "ec", ecKey, validClaims()), valid: true},
+		{name: "ES256 without kid", token: sign(t, jwt.SigningMethodES256, "", ecKey, validClaims()), valid: true},
+		{name: "wrong secret", token: sign(t, jwt.SigningMethodHS256, "", []byte("guess"), validClaims())},
+		{name: "wrong key", token: sign(t, jwt.SigningMethodES256, "ec", otherECKey, validClaims())},
+		{name: "unknown kid", token: sign(t, jwt.SigningMethodRS256, "other", rsaKey, validClaims())},
+		{name: "kid of another algorithm", token: sign(t, jwt.SigningMethodES256, "rsa", ecKey, validClaims())},
+		{name: "unsupported algorithm", token: sign(t, jwt.SigningMethodHS512, "", []byte(secret), validClaims())},
+		{name: "unsigned", token: sign(t, jwt.SigningMethodNone, "", jwt.UnsafeAllowNoneSignatureType, validClaims())},
+		{name: "expired", token: sign(t, jwt.SigningMethodHS256, "", []byte(secret),
+			with("exp", time.Now().Add(-time.Minute).Unix()))},
+		{name: "without expiry", token: sign(t, jwt.SigningMethodHS256, "", []byte(secret), with("exp", nil))},
+		{name: "other issuer", token: sign(t, jwt.SigningMethodHS256, "", []byte(secret), with("iss", "someone"))},
+		{name: "other audience", token: sign(t, jwt.SigningMethodHS256, "", []byte(secret), with("aud", "other"))},
+		{name: "issued in the future", token: sign(t, jwt.SigningMethodHS256, "", []byte(secret),
+			with("iat", time.Now().Add(time.Hour).Unix()))},
+		{name: "malformed", token: "not.a.token"},
+	}
+
+	for _, tt := range tests {
+		ttCpy := tt
+
+		t.Run(ttCpy.name, func(t *testing.T) {
+			r := require.New(t)
+
+			claims, err := verifier.Verify(ttCpy.token)
+			if !ttCpy.valid {
+				r.ErrorIs(err, auth.ErrInvalidToken)
+				return
+			}
+
+			r.NoError(err)
+			r.Equal("alice", claims.Subject)
+			r.Equal(issuer, claims.Issuer)
+			r.Equal([]string{audience}, claims.Audience)
+			r.WithinDuration(time.Now().Add(time.Hour), claims.ExpiresAt, time.Minute)
+			r.Equal("users:write", claims.All["scope"])
+		})
+	}
+}
+
+func TestVerifierLeeway(t *testing.T) {
+	r := require.New(t)
+
+	verifier, err := auth.NewVerifier(auth.Config{
+		HS256Secret: secret,
+		Issuer:      issuer,
+		Audience:    audience,
+		Leeway:      time.Minute,
+	})
+	r.NoError(err)
+
+	claims := validClaims()
+	claims["exp"] = time.Now().Add(-30 * time.Second).Unix()
+
+	_, err = verifier.Verify(sign(t, jwt.SigningMethodHS256, "", []byte(secret), claims))
+	r.NoError(err)
+
+	// RS256 tokens are rejected when no RSA key is configured
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	r.NoError(err)
+
+	_, err = verifier.Verify(sign(t, jwt.SigningMethodRS256, "", rsaKey, validClaims()))
+	r.ErrorIs(err, auth.ErrInvalidToken)
+}
+
+func TestNewVerifierInvalid(t *testing.T) {
+	jwks := func(content string) string {
+		path := filepath.Join(t.TempDir(), "jwks.json")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+		return path
+	}
+
+	tests := []struct {
+		name   string
+		config auth.Config
+	}{
+		{name: "no key", config: auth.Config{Issuer: issuer, Audience: audience}},
+		{name: "no issuer", config: auth.Config{HS256Secret: secret, Audience: audience}},
+		{name: "no audience", config: auth.Config{HS256Secret: secret, Issuer: issuer}},
+		{name: "missing JWKS file", config: auth.Config{JWKSFile: "missing.json", Issuer: issuer, Audience: audience}},
+		{name: "malformed JWKS", config: auth.Config{JWKSFile: jwks("{"), Issuer: issuer, Audience: audience}},
+		{name: "empty JWKS", config: auth.Config{JWKSFile: jwks(`{"keys": []}`), Issuer: issuer, Audience: audience}},
+		{name: "short RSA key", config: auth.Config{
+			JWKSFile: jwks(`{"keys": [{"kty": "RSA", "n": "AQAB", "e": "AQAB"}]}`), Issuer: issuer, Audience: audience,
+		}},
+		{name: "point not on the curve", config: auth.Config{
+			JWKSFile: jwks(`{"keys": [{"kty": "EC", "crv": "P-256", "x": "` + b64(make([]byte, 32)) + `", "y": "` +
+				b64(make([]byte, 32)) + `"}]}`),
+			Issuer:   issuer,
+			Audience: audience,
+		}},
+		{name: "unsupported curve", config: auth.Config{
+			JWKSFile: jwks(`{"keys": [{"kty": "EC", "crv": "P-384", "x": "AQAB", "y": "AQAB"}]}`), Issuer: issuer,
+			Audience: audience,
+		}},
+	}
+
+	for _, tt := range tests {
+		ttCpy := tt
+
+		t.Run(ttCpy.name, func(t *testing.T) {
+			_, err := auth.NewVerifier(ttCpy.config)
+			require.ErrorIs(t, err, auth.ErrInvalid)
+		})
+	}
+}
+
+func TestContext(t *testing.T) {
+	r := require.New(t)
+
+	_, ok := auth.FromContext(context.Background())
+	r.False(ok)
+
+	claims := &auth.Claims{Subject: "alice"}
+	actual, ok := auth.FromContext(auth.NewContext(context.Background(), claims))
+	r.True(ok)
+	r.Same(claims, actual)
+}
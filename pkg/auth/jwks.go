@@ -0,0 +1,174 @@
+package auth
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+// minRSABits is the smallest RSA key accepted, as recommended for RS256 by RFC 7518.
+const minRSABits = 2048
+
+// jwks holds the signing keys of a JSON Web Key Set (RFC 7517).
+type jwks []jwk
+
+type jwk struct {
+	kid string
+	key any
+}
+
+func (s jwks) has(alg string) bool {
+	for _, k := range s {
+		if algorithm(k.key) == alg {
+			return true
+		}
+	}
+
+	return false
+}
+
+// lookup returns the key of the given kid, or the only key of the algorithm when kid is empty.
+func (s jwks) lookup(alg, kid string) (any, error) {
+	var found []any
+
+	for _, k := range s {
+		if algorithm(k.key) == alg && (kid == "" || k.kid == kid) {
+			found = append(found, k.key)
+		}
+	}
+
+	switch {
+	case len(found) == 1:
+		return found[0], nil
+	case len(found) == 0:
+		return nil, fmt.Errorf("no %s key with kid %q", alg, kid)
+	default:
+		return nil, fmt.Errorf("several %s keys match, the token must name its key with kid", alg)
+	}
+}
+
+// jsonWebKey is the JSON representation of an RSA or EC public key.
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// loadJWKS reads the signing keys of a JWKS file. The keys meant for encryption are skipped.
+func loadJWKS(path string) (jwks, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: could not read the JWKS file: %w", ErrInvalid, err)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+
+	if err := json.Unmarshal(b, &set); err != nil {
+		return nil, fmt.Errorf("%w: could not decode the JWKS file %s: %w", ErrInvalid, path, err)
+	}
+
+	var keys jwks
+
+	kids := map[string]bool{}
+
+	for i, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("%w: key %d of %s: %w", ErrInvalid, i, path, err)
+		}
+
+		if k.Alg != "" && k.Alg != algorithm(key) {
+			return nil, fmt.Errorf("%w: key %d of %s: alg %s is not supported for the key", ErrInvalid, i, path, k.Alg)
+		}
+
+		if k.Kid != "" && kids[k.Kid] {
+			return nil, fmt.Errorf("%w: key %d of %s: duplicate kid %q", ErrInvalid, i, path, k.Kid)
+		}
+
+		kids[k.Kid] = true
+		keys = append(keys, jwk{kid: k.Kid, key: key})
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w: %s has no signing key", ErrInvalid, path)
+	}
+
+	return keys, nil
+}
+
+func (k *jsonWebKey) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		return k.rsaPublicKey()
+	case "EC":
+		return k.ecPublicKey()
+	default:
+		return nil, fmt.Errorf("kty %q is not supported, expected RSA or EC", k.Kty)
+	}
+}
+
+func (k *jsonWebKey) rsaPublicKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("n: %w", err)
+	}
+
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("e: %w", err)
+	}
+
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+		return nil, errors.New("e is out of range")
+	}
+
+	key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}
+	if key.N.BitLen() < minRSABits {
+		return nil, fmt.Errorf("the key has %d bits, at least %d are required", key.N.BitLen(), minRSABits)
+	}
+
+	return key, nil
+}
+
+func (k *jsonWebKey) ecPublicKey() (*ecdsa.PublicKey, error) {
+	if k.Crv != "P-256" {
+		return nil, fmt.Errorf("crv %q is not supported, expected P-256", k.Crv)
+	}
+
+	x, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil {
+		return nil, fmt.Errorf("x: %w", err)
+	}
+
+	y, err := base64.RawURLEncoding.DecodeString(k.Y)
+	if err != nil {
+		return nil, fmt.Errorf("y: %w", err)
+	}
+
+	// checks that the point is on the curve
+	if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+		return nil, fmt.Errorf("invalid point: %w", err)
+	}
+
+	return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+}
@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrInvalid      = errors.New("invalid auth configuration")
+)
+
+// Algorithms of the signatures that Verifier accepts.
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	ES256 = "ES256"
+)
+
+type Config struct {
+	// HS256Secret verifies the tokens signed with HS256.
+	HS256Secret string
+	// JWKSFile is a JSON Web Key Set file whose RSA keys verify the tokens signed with RS256, and P-256 keys the ones
+	// signed with ES256. Tokens pick their key with the kid header, which can be omitted when the set has a single key
+	// of their type.
+	JWKSFile string
+	// Issuer and Audience are required, and must match the iss and aud claims.
+	Issuer   string
+	Audience string
+	// Leeway tolerates clock skew when checking the exp, nbf and iat claims.
+	Leeway time.Duration
+}
+
+// Enabled tells whether a key to verify tokens with is configured.
+func (c Config) Enabled() bool {
+	return c.HS256Secret != "" || c.JWKSFile != ""
+}
+
+// Verifier checks the signature, issuer, audience and expiry of tokens. Tokens without expiry are rejected.
+type Verifier struct {
+	parser  *jwt.Parser
+	hmacKey []byte
+	keys    jwks
+}
+
+func NewVerifier(config Config) (*Verifier, error) {
+	if !config.Enabled() {
+		return nil, fmt.Errorf("%w: a secret or a JWKS file is required", ErrInvalid)
+	}
+
+	if config.Issuer == "" || config.Audience == "" {
+		return nil, fmt.Errorf("%w: the issuer and the audience are required", ErrInvalid)
+	}
+
+	v := &Verifier{keys: jwks{}}
+
+	var methods []string
+
+	if config.HS256Secret != "" {
+		v.hmacKey = []byte(config.HS256Secret)
+		methods = append(methods, HS256)
+	}
+
+	if config.JWKSFile != "" {
+		keys, err := loadJWKS(config.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+
+		v.keys = keys
+
+		if keys.has(RS256) {
+			methods = append(methods, RS256)
+		}
+
+		if keys.has(ES256) {
+			methods = append(methods, ES256)
+		}
+	}
+
+	v.parser = jwt.NewParser(
+		jwt.WithValidMethods(methods),
+		jwt.WithIssuer(config.Issuer),
+		jwt.WithAudience(config.Audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(config.Leeway),
+	)
+
+	return v, nil
+}
+
+// Verify returns the claims of a valid token. Any other token fails with ErrInvalidToken.
+func (v *Verifier) Verify(token string) (*Claims, error) {
+	mapClaims := jwt.MapClaims{}
+
+	if _, err := v.parser.ParseWithClaims(token, mapClaims, v.key); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	// the parser checked the registered claims, so they are well-formed
+	claims := &Claims{All: mapClaims}
+	claims.Subject, _ = mapClaims.GetSubject()
+	claims.Issuer, _ = mapClaims.GetIssuer()
+	claims.Audience, _ = mapClaims.GetAudience()
+
+	if exp, _ := mapClaims.GetExpirationTime(); exp != nil {
+		claims.ExpiresAt = exp.Time
+	}
+
+	return claims, nil
+}
+
+// key returns the key that verifies the signature of token. Its algorithm is one of the valid methods of the parser.
+func (v *Verifier) key(token *jwt.Token) (any, error) {
+	alg := token.Method.Alg()
+	if alg == HS256 {
+		return v.hmacKey, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+
+	return v.keys.lookup(alg, kid)
+}
+
+// algorithm returns the signature algorithm that key verifies.
+func algorithm(key any) string {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return RS256
+	case *ecdsa.PublicKey:
+		if k.Curve == elliptic.P256() {
+			return ES256
+		}
+	}
+
+	return ""
+}
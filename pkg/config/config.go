@@ -0,0 +1,435 @@
+// Package config loads the configuration of the server from a YAML or TOML file, environment variables and command
+// line flags. Each source overrides the previous one: defaults, then the file, then the environment, then the flags.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/PopescuStefanRadu/ent-demo/pkg/app"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/auth"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/entwrap"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/external/dog"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/external/photo"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/http/server"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/telemetry"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/user"
+	"github.com/sony/gobreaker"
+)
+
+// InMemoryDBUrl is used when DB.URL is empty. The in-memory database starts empty on every run, so it is always
+// migrated on start.
+const InMemoryDBUrl = "file:ent?mode=memory&cache=shared&_fk=1"
+
+var ErrInvalid = errors.New("invalid configuration")
+
+// Duration is a time.Duration written like "1m30s" in files, environment variables and flags.
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(parsed)
+
+	return nil
+}
+
+// Config is the layout of the configuration file. See Default for the default values.
+type Config struct {
+	Server     ServerConfig     `toml:"server" yaml:"server"`
+	DB         DBConfig         `toml:"db" yaml:"db"`
+	Enrichment EnrichmentConfig `toml:"enrichment" yaml:"enrichment"`
+	Photo      PhotoConfig      `toml:"photo" yaml:"photo"`
+	Prefetch   PrefetchConfig   `toml:"prefetch" yaml:"prefetch"`
+	Telemetry  TelemetryConfig  `toml:"telemetry" yaml:"telemetry"`
+	Auth       AuthConfig       `toml:"auth" yaml:"auth"`
+}
+
+type ServerConfig struct {
+	Address         string   `toml:"address" yaml:"address"`
+	ShutdownTimeout Duration `toml:"shutdown_timeout" yaml:"shutdown_timeout"`
+	// AdminToken is a secret, see server.RouterConfig.
+	AdminToken string `toml:"admin_token" yaml:"admin_token"`
+}
+
+type DBConfig struct {
+	Dialect string `toml:"dialect" yaml:"dialect"`
+	// URL may contain a password, which is redacted when the configuration is printed.
+	URL            string `toml:"url" yaml:"url"`
+	Debug          bool   `toml:"debug" yaml:"debug"`
+	MigrateOnStart bool   `toml:"migrate_on_start" yaml:"migrate_on_start"`
+}
+
+type EnrichmentConfig struct {
+	Mode           string `toml:"mode" yaml:"mode"`
+	MaxConcurrency int    `toml:"max_concurrency" yaml:"max_concurrency"`
+}
+
+// PhotoConfig selects a photo provider, see photo.ProviderConfig. The HTTP settings are used by the random.dog and
+// dog.ceo providers, StaticFile by the static one and Chain by the chain one.
+type PhotoConfig struct {
+	Provider       string               `toml:"provider" yaml:"provider"`
+	BaseURL        string               `toml:"base_url" yaml:"base_url"`
+	Path           string               `toml:"path,omitempty" yaml:"path,omitempty"`
+	CircuitBreaker CircuitBreakerConfig `toml:"circuit_breaker" yaml:"circuit_breaker"`
+	Retry          RetryConfig          `toml:"retry" yaml:"retry"`
+	Validation     ValidationConfig     `toml:"validation" yaml:"validation"`
+	Cache          CacheConfig          `toml:"cache" yaml:"cache"`
+	StaticFile     string               `toml:"static_file,omitempty" yaml:"static_file,omitempty"`
+	Chain          *ChainConfig         `toml:"chain,omitempty" yaml:"chain,omitempty"`
+}
+
+type CircuitBreakerConfig struct {
+	// MaxRequests is the number of requests let through while half-open.
+	MaxRequests uint32 `toml:"max_requests" yaml:"max_requests"`
+	// Interval is the period after which the failure counts are cleared while closed.
+	Interval Duration `toml:"interval" yaml:"interval"`
+	// Timeout is how long the breaker stays open.
+	Timeout Duration `toml:"timeout" yaml:"timeout"`
+	// ConsecutiveFailures trips the breaker. Zero keeps the default of gobreaker.
+	ConsecutiveFailures uint32 `toml:"consecutive_failures" yaml:"consecutive_failures"`
+}
+
+type RetryConfig struct {
+	MaxRetries      uint64   `toml:"max_retries" yaml:"max_retries"`
+	AttemptTimeout  Duration `toml:"attempt_timeout" yaml:"attempt_timeout"`
+	Deadline        Duration `toml:"deadline" yaml:"deadline"`
+	InitialInterval Duration `toml:"initial_interval" yaml:"initial_interval"`
+	MaxInterval     Duration `toml:"max_interval" yaml:"max_interval"`
+}
+
+type ValidationConfig struct {
+	MaxBodySize       int64    `toml:"max_body_size" yaml:"max_body_size"`
+	AllowedSchemes    []string `toml:"allowed_schemes" yaml:"allowed_schemes"`
+	AllowedHosts      []string `toml:"allowed_hosts" yaml:"allowed_hosts"`
+	AllowedExtensions []string `toml:"allowed_extensions" yaml:"allowed_extensions"`
+	MaxRedraws        int      `toml:"max_redraws" yaml:"max_redraws"`
+}
+
+// CacheConfig configures the URLs kept to answer when the dog API fails or is slow, see dog.CacheConfig. It does not
+// reduce the calls to the dog API.
+type CacheConfig struct {
+	Size       int      `toml:"size" yaml:"size"`
+	TTL        Duration `toml:"ttl" yaml:"ttl"`
+	ServeAfter Duration `toml:"serve_after" yaml:"serve_after"`
+}
+
+type ChainConfig struct {
+	Mode  string            `toml:"mode" yaml:"mode"`
+	Links []ChainLinkConfig `toml:"links" yaml:"links"`
+}
+
+// ChainLinkConfig is a provider of a chain. In a file, the settings that a link leaves unset, except its provider and
+// base URL, are those of Default.Photo, not of the photo section around it.
+type ChainLinkConfig struct {
+	Weight      int `toml:"weight" yaml:"weight"`
+	PhotoConfig `yaml:",inline"`
+}
+
+type PrefetchConfig struct {
+	Size            int      `toml:"size" yaml:"size"`
+	MaxAge          Duration `toml:"max_age" yaml:"max_age"`
+	InitialInterval Duration `toml:"initial_interval" yaml:"initial_interval"`
+	MaxInterval     Duration `toml:"max_interval" yaml:"max_interval"`
+}
+
+// TelemetryConfig configures tracing, see telemetry.Config.
+type TelemetryConfig struct {
+	Exporter     string  `toml:"exporter" yaml:"exporter"`
+	ServiceName  string  `toml:"service_name" yaml:"service_name"`
+	OTLPEndpoint string  `toml:"otlp_endpoint" yaml:"otlp_endpoint"`
+	OTLPInsecure bool    `toml:"otlp_insecure" yaml:"otlp_insecure"`
+	SampleRatio  float64 `toml:"sample_ratio" yaml:"sample_ratio"`
+}
+
+// AuthConfig configures the authentication of the callers, see auth.Config. The server requires HS256Secret or
+// JWKSFile, unless Disabled explicitly serves the API without authentication.
+type AuthConfig struct {
+	Disabled bool `toml:"disabled" yaml:"disabled"`
+	// HS256Secret is a secret, redacted when the configuration is printed.
+	HS256Secret string   `toml:"hs256_secret" yaml:"hs256_secret"`
+	JWKSFile    string   `toml:"jwks_file" yaml:"jwks_file"`
+	Issuer      string   `toml:"issuer" yaml:"issuer"`
+	Audience    string   `toml:"audience" yaml:"audience"`
+	Leeway      Duration `toml:"leeway" yaml:"leeway"`
+}
+
+// Default returns the configuration used for the settings that no source sets.
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Address:         ":8080",
+			ShutdownTimeout: Duration(30 * time.Second), //nolint:gomnd
+		},
+		DB: DBConfig{
+			Dialect: app.DefaultDBDialect,
+		},
+		Enrichment: EnrichmentConfig{
+			Mode:           string(user.EnrichStrict),
+			MaxConcurrency: user.DefaultEnrichmentConcurrency,
+		},
+		Photo: PhotoConfig{
+			Provider: photo.TypeRandomDog,
+			BaseURL:  "https://random.dog",
+			Retry: RetryConfig{
+				MaxRetries:      2, //nolint:gomnd
+				AttemptTimeout:  Duration(2 * time.Second),
+				Deadline:        Duration(5 * time.Second),        //nolint:gomnd
+				InitialInterval: Duration(100 * time.Millisecond), //nolint:gomnd
+				MaxInterval:     Duration(time.Second),
+			},
+			Validation: ValidationConfig{
+				MaxBodySize:       dog.DefaultMaxBodySize,
+				AllowedSchemes:    []string{"https"},
+				AllowedHosts:      dog.ImageHosts(),
+				AllowedExtensions: []string{".jpg", ".jpeg", ".png", ".gif"},
+				MaxRedraws:        3, //nolint:gomnd
+			},
+			Cache: CacheConfig{
+				Size:       100, //nolint:gomnd
+				TTL:        Duration(time.Hour),
+				ServeAfter: Duration(500 * time.Millisecond), //nolint:gomnd
+			},
+		},
+		Prefetch: PrefetchConfig{
+			Size:            50, //nolint:gomnd
+			MaxAge:          Duration(time.Hour),
+			InitialInterval: Duration(time.Second),
+			MaxInterval:     Duration(time.Minute),
+		},
+		Telemetry: TelemetryConfig{
+			Exporter:    telemetry.ExporterNone,
+			ServiceName: telemetry.DefaultServiceName,
+			SampleRatio: 1,
+		},
+	}
+}
+
+// Validate reports all the invalid settings at once, wrapped in ErrInvalid.
+func (c *Config) Validate() error {
+	var errs []error
+
+	invalid := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%w: "+format, append([]any{ErrInvalid}, args...)...))
+	}
+
+	if c.Server.Address == "" {
+		invalid("server.address is required")
+	}
+
+	if !slices.Contains(entwrap.Dialects(), c.DB.Dialect) {
+		invalid("db.dialect %q, expected one of %v", c.DB.Dialect, entwrap.Dialects())
+	}
+
+	if mode := user.EnrichmentMode(c.Enrichment.Mode); mode != user.EnrichStrict && mode != user.EnrichDegrade {
+		invalid("enrichment.mode %q, expected %s or %s", c.Enrichment.Mode, user.EnrichStrict, user.EnrichDegrade)
+	}
+
+	if c.Enrichment.MaxConcurrency < 0 {
+		invalid("enrichment.max_concurrency cannot be negative")
+	}
+
+	errs = append(errs, c.Photo.validate("photo")...)
+
+	if c.Prefetch.Size < 0 {
+		invalid("prefetch.size cannot be negative")
+	}
+
+	if !slices.Contains(telemetry.Exporters(), c.Telemetry.Exporter) {
+		invalid("telemetry.exporter %q, expected one of %v", c.Telemetry.Exporter, telemetry.Exporters())
+	}
+
+	if c.Telemetry.SampleRatio < 0 || c.Telemetry.SampleRatio > 1 {
+		invalid("telemetry.sample_ratio must be between 0 and 1")
+	}
+
+	if c.AuthConfig().Enabled() && (c.Auth.Issuer == "" || c.Auth.Audience == "") {
+		invalid("auth.issuer and auth.audience are required when auth is enabled")
+	}
+
+	if c.AuthConfig().Enabled() && c.Auth.Disabled {
+		invalid("auth.disabled cannot be set together with auth.hs256_secret or auth.jwks_file")
+	}
+
+	if c.Auth.Leeway < 0 {
+		invalid("auth.leeway cannot be negative")
+	}
+
+	return errors.Join(errs...)
+}
+
+func (p *PhotoConfig) validate(key string) []error {
+	var errs []error
+
+	invalid := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%w: %s."+format, append([]any{ErrInvalid, key}, args...)...))
+	}
+
+	if !slices.Contains(photo.Types(), p.Provider) {
+		invalid("provider %q, expected one of %v", p.Provider, photo.Types())
+	}
+
+	switch p.Provider {
+	case photo.TypeRandomDog, photo.TypeDogCEO:
+		if u, err := url.Parse(p.BaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+			invalid("base_url %q is not an absolute URL", p.BaseURL)
+		}
+	case photo.TypeStatic:
+		if p.StaticFile == "" {
+			invalid("static_file is required by the %s provider", photo.TypeStatic)
+		}
+	case photo.TypeChain:
+		if p.Chain == nil || len(p.Chain.Links) == 0 {
+			invalid("chain.links is required by the %s provider", photo.TypeChain)
+			break
+		}
+
+		for i := range p.Chain.Links {
+			link := &p.Chain.Links[i]
+			if link.Weight < 0 {
+				invalid("chain.links[%d].weight cannot be negative", i)
+			}
+
+			errs = append(errs, link.validate(fmt.Sprintf("%s.chain.links[%d]", key, i))...)
+		}
+	}
+
+	if p.Cache.Size < 0 {
+		invalid("cache.size cannot be negative")
+	}
+
+	if p.Validation.MaxRedraws < 0 {
+		invalid("validation.max_redraws cannot be negative")
+	}
+
+	return errs
+}
+
+// ServerConfig converts the configuration for server.NewHTTPServer.
+func (c *Config) ServerConfig() server.Config {
+	dbURL, migrateOnStart := c.DB.URL, c.DB.MigrateOnStart
+	if dbURL == "" {
+		dbURL, migrateOnStart = InMemoryDBUrl, true
+	}
+
+	return server.Config{
+		ShutdownTimeout: time.Duration(c.Server.ShutdownTimeout),
+		Address:         c.Server.Address,
+		AppConfig: &app.Config{
+			DBDialect:        c.DB.Dialect,
+			DBUrl:            dbURL,
+			DebugPersistence: c.DB.Debug,
+			MigrateOnStart:   migrateOnStart,
+			PhotoProvider:    c.Photo.providerConfig(),
+			Prefetch: dog.PrefetchConfig{
+				Size:            c.Prefetch.Size,
+				MaxAge:          time.Duration(c.Prefetch.MaxAge),
+				InitialInterval: time.Duration(c.Prefetch.InitialInterval),
+				MaxInterval:     time.Duration(c.Prefetch.MaxInterval),
+			},
+			Enrichment: user.EnrichmentConfig{
+				Mode:           user.EnrichmentMode(c.Enrichment.Mode),
+				MaxConcurrency: c.Enrichment.MaxConcurrency,
+			},
+		},
+		RouterConfig: server.RouterConfig{
+			AdminToken:  c.Server.AdminToken,
+			ServiceName: c.Telemetry.ServiceName,
+		},
+		Auth:         c.AuthConfig(),
+		AuthDisabled: c.Auth.Disabled,
+	}
+}
+
+// AuthConfig converts the configuration for auth.NewVerifier.
+func (c *Config) AuthConfig() auth.Config {
+	return auth.Config{
+		HS256Secret: c.Auth.HS256Secret,
+		JWKSFile:    c.Auth.JWKSFile,
+		Issuer:      c.Auth.Issuer,
+		Audience:    c.Auth.Audience,
+		Leeway:      time.Duration(c.Auth.Leeway),
+	}
+}
+
+// TelemetryConfig converts the configuration for telemetry.Setup.
+func (c *Config) TelemetryConfig() telemetry.Config {
+	return telemetry.Config{
+		Exporter:     c.Telemetry.Exporter,
+		ServiceName:  c.Telemetry.ServiceName,
+		OTLPEndpoint: c.Telemetry.OTLPEndpoint,
+		OTLPInsecure: c.Telemetry.OTLPInsecure,
+		SampleRatio:  c.Telemetry.SampleRatio,
+	}
+}
+
+func (p *PhotoConfig) providerConfig() photo.ProviderConfig {
+	config := photo.ProviderConfig{
+		Type:   p.Provider,
+		HTTP:   p.clientConfig(),
+		Static: photo.StaticConfig{File: p.StaticFile},
+	}
+
+	if p.Chain != nil {
+		config.Chain.Mode = photo.ChainMode(p.Chain.Mode)
+
+		for _, link := range p.Chain.Links {
+			config.Chain.Links = append(config.Chain.Links, photo.ChainLink{
+				Weight:   link.Weight,
+				Provider: link.providerConfig(),
+			})
+		}
+	}
+
+	return config
+}
+
+func (p *PhotoConfig) clientConfig() dog.ClientConfig {
+	settings := gobreaker.Settings{
+		Name:        p.Provider,
+		MaxRequests: p.CircuitBreaker.MaxRequests,
+		Interval:    time.Duration(p.CircuitBreaker.Interval),
+		Timeout:     time.Duration(p.CircuitBreaker.Timeout),
+	}
+
+	if failures := p.CircuitBreaker.ConsecutiveFailures; failures > 0 {
+		settings.ReadyToTrip = func(counts gobreaker.Counts) bool {
+			return counts.ConsecutiveFailures >= failures
+		}
+	}
+
+	return dog.ClientConfig{
+		BaseURL:                p.BaseURL,
+		Path:                   p.Path,
+		CircuitBreakerSettings: settings,
+		Retry: dog.RetryConfig{
+			MaxRetries:      p.Retry.MaxRetries,
+			AttemptTimeout:  time.Duration(p.Retry.AttemptTimeout),
+			Deadline:        time.Duration(p.Retry.Deadline),
+			InitialInterval: time.Duration(p.Retry.InitialInterval),
+			MaxInterval:     time.Duration(p.Retry.MaxInterval),
+		},
+		Validation: dog.ValidationConfig{
+			MaxBodySize:       p.Validation.MaxBodySize,
+			AllowedSchemes:    p.Validation.AllowedSchemes,
+			AllowedHosts:      p.Validation.AllowedHosts,
+			AllowedExtensions: p.Validation.AllowedExtensions,
+			MaxRedraws:        p.Validation.MaxRedraws,
+		},
+		Cache: dog.CacheConfig{
+			Size:       p.Cache.Size,
+			TTL:        time.Duration(p.Cache.TTL),
+			ServeAfter: time.Duration(p.Cache.ServeAfter),
+		},
+	}
+}
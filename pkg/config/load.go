@@ -0,0 +1,387 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// FileEnv names the configuration file when the -config flag is not given.
+const FileEnv = "CONFIG_FILE"
+
+// Options are the command line flags that are not settings.
+type Options struct {
+	// File is the YAML or TOML configuration file, told apart by its extension.
+	File string
+	// PrintConfig asks to print the configuration, with its secrets redacted, instead of running.
+	PrintConfig bool
+}
+
+// setting binds a field of Config to an environment variable and a flag. The flag is named after the key, e.g.
+// -photo-retry-max-retries for photo.retry.max_retries.
+type setting struct {
+	key   string
+	env   string
+	usage string
+	value func(c *Config) flag.Value
+}
+
+func (s setting) flagName() string {
+	return strings.NewReplacer(".", "-", "_", "-").Replace(s.key)
+}
+
+//nolint:gochecknoglobals,lll
+var settings = []setting{
+	{"server.address", "SERVER_ADDRESS", "address to listen on", func(c *Config) flag.Value { return stringVar(&c.Server.Address) }},
+	{"server.shutdown_timeout", "SERVER_SHUTDOWN_TIMEOUT", "time given to the requests in progress to finish on shutdown", func(c *Config) flag.Value { return durationVar(&c.Server.ShutdownTimeout) }},
+	{"server.admin_token", "ADMIN_TOKEN", "token of the /admin routes, which are disabled when empty", func(c *Config) flag.Value { return stringVar(&c.Server.AdminToken) }},
+	{"db.dialect", "DB_DIALECT", "dialect of the database", func(c *Config) flag.Value { return stringVar(&c.DB.Dialect) }},
+	{"db.url", "DB_URL", "database to connect to, an in-memory database migrated on start when empty", func(c *Config) flag.Value { return stringVar(&c.DB.URL) }},
+	{"db.debug", "DB_DEBUG", "log the queries", func(c *Config) flag.Value { return boolVar(&c.DB.Debug) }},
+	{"db.migrate_on_start", "DB_MIGRATE_ON_START", "apply the pending migrations on start", func(c *Config) flag.Value { return boolVar(&c.DB.MigrateOnStart) }},
+	{"enrichment.mode", "ENRICHMENT_MODE", "strict or degrade, when the photo of a new user cannot be fetched", func(c *Config) flag.Value { return stringVar(&c.Enrichment.Mode) }},
+	{"enrichment.max_concurrency", "ENRICHMENT_MAX_CONCURRENCY", "photos fetched at the same time for a batch", func(c *Config) flag.Value { return intVar(&c.Enrichment.MaxConcurrency) }},
+	{"photo.provider", "PHOTO_PROVIDER", "provider of the photos", func(c *Config) flag.Value { return stringVar(&c.Photo.Provider) }},
+	{"photo.base_url", "PHOTO_BASE_URL", "base URL of the dog API", func(c *Config) flag.Value { return stringVar(&c.Photo.BaseURL) }},
+	{"photo.path", "PHOTO_PATH", "path of the dog API, the default of the provider when empty", func(c *Config) flag.Value { return stringVar(&c.Photo.Path) }},
+	{"photo.static_file", "PHOTO_STATIC_FILE", "file of URLs of the static provider", func(c *Config) flag.Value { return stringVar(&c.Photo.StaticFile) }},
+	{"photo.circuit_breaker.max_requests", "PHOTO_CIRCUIT_BREAKER_MAX_REQUESTS", "requests let through while half-open", func(c *Config) flag.Value { return uint32Var(&c.Photo.CircuitBreaker.MaxRequests) }},
+	{"photo.circuit_breaker.interval", "PHOTO_CIRCUIT_BREAKER_INTERVAL", "period after which the failures are forgotten", func(c *Config) flag.Value { return durationVar(&c.Photo.CircuitBreaker.Interval) }},
+	{"photo.circuit_breaker.timeout", "PHOTO_CIRCUIT_BREAKER_TIMEOUT", "time the breaker stays open", func(c *Config) flag.Value { return durationVar(&c.Photo.CircuitBreaker.Timeout) }},
+	{"photo.circuit_breaker.consecutive_failures", "PHOTO_CIRCUIT_BREAKER_CONSECUTIVE_FAILURES", "failures that open the breaker", func(c *Config) flag.Value { return uint32Var(&c.Photo.CircuitBreaker.ConsecutiveFailures) }},
+	{"photo.retry.max_retries", "PHOTO_RETRY_MAX_RETRIES", "attempts after the first one", func(c *Config) flag.Value { return uint64Var(&c.Photo.Retry.MaxRetries) }},
+	{"photo.retry.attempt_timeout", "PHOTO_RETRY_ATTEMPT_TIMEOUT", "timeout of each attempt", func(c *Config) flag.Value { return durationVar(&c.Photo.Retry.AttemptTimeout) }},
+	{"photo.retry.deadline", "PHOTO_RETRY_DEADLINE", "timeout of all the attempts together", func(c *Config) flag.Value { return durationVar(&c.Photo.Retry.Deadline) }},
+	{"photo.retry.initial_interval", "PHOTO_RETRY_INITIAL_INTERVAL", "wait before the first retry", func(c *Config) flag.Value { return durationVar(&c.Photo.Retry.InitialInterval) }},
+	{"photo.retry.max_interval", "PHOTO_RETRY_MAX_INTERVAL", "maximum wait between two attempts", func(c *Config) flag.Value { return durationVar(&c.Photo.Retry.MaxInterval) }},
+	{"photo.validation.max_body_size", "PHOTO_VALIDATION_MAX_BODY_SIZE", "largest response read, in bytes", func(c *Config) flag.Value { return int64Var(&c.Photo.Validation.MaxBodySize) }},
+	{"photo.validation.allowed_schemes", "PHOTO_VALIDATION_ALLOWED_SCHEMES", "comma separated schemes of the URLs", func(c *Config) flag.Value { return listVar(&c.Photo.Validation.AllowedSchemes) }},
+	{"photo.validation.allowed_hosts", "PHOTO_VALIDATION_ALLOWED_HOSTS", "comma separated hosts of the URLs, any when empty", func(c *Config) flag.Value { return listVar(&c.Photo.Validation.AllowedHosts) }},
+	{"photo.validation.allowed_extensions", "PHOTO_VALIDATION_ALLOWED_EXTENSIONS", "comma separated extensions of the URLs, any when empty", func(c *Config) flag.Value { return listVar(&c.Photo.Validation.AllowedExtensions) }},
+	{"photo.validation.max_redraws", "PHOTO_VALIDATION_MAX_REDRAWS", "new URLs requested when one has a disallowed extension", func(c *Config) flag.Value { return intVar(&c.Photo.Validation.MaxRedraws) }},
+	{"photo.cache.size", "PHOTO_CACHE_SIZE", "URLs kept to answer when the dog API fails, disabled when 0", func(c *Config) flag.Value { return intVar(&c.Photo.Cache.Size) }},
+	{"photo.cache.ttl", "PHOTO_CACHE_TTL", "time a URL can be served from the cache", func(c *Config) flag.Value { return durationVar(&c.Photo.Cache.TTL) }},
+	{"photo.cache.serve_after", "PHOTO_CACHE_SERVE_AFTER", "wait for the dog API before answering from the cache", func(c *Config) flag.Value { return durationVar(&c.Photo.Cache.ServeAfter) }},
+	{"prefetch.size", "PREFETCH_SIZE", "URLs fetched ahead of time, disabled when 0", func(c *Config) flag.Value { return intVar(&c.Prefetch.Size) }},
+	{"prefetch.max_age", "PREFETCH_MAX_AGE", "time a prefetched URL can be served", func(c *Config) flag.Value { return durationVar(&c.Prefetch.MaxAge) }},
+	{"prefetch.initial_interval", "PREFETCH_INITIAL_INTERVAL", "wait before prefetching again after a failure", func(c *Config) flag.Value { return durationVar(&c.Prefetch.InitialInterval) }},
+	{"prefetch.max_interval", "PREFETCH_MAX_INTERVAL", "maximum wait between two failed prefetches", func(c *Config) flag.Value { return durationVar(&c.Prefetch.MaxInterval) }},
+	{"telemetry.exporter", "TELEMETRY_EXPORTER", "exporter of the spans: none, stdout or otlp", func(c *Config) flag.Value { return stringVar(&c.Telemetry.Exporter) }},
+	{"telemetry.service_name", "TELEMETRY_SERVICE_NAME", "name of the service in the spans", func(c *Config) flag.Value { return stringVar(&c.Telemetry.ServiceName) }},
+	{"telemetry.otlp_endpoint", "TELEMETRY_OTLP_ENDPOINT", "host and port of the OTLP/HTTP collector", func(c *Config) flag.Value { return stringVar(&c.Telemetry.OTLPEndpoint) }},
+	{"telemetry.otlp_insecure", "TELEMETRY_OTLP_INSECURE", "send the spans to the collector over plain HTTP", func(c *Config) flag.Value { return boolVar(&c.Telemetry.OTLPInsecure) }},
+	{"telemetry.sample_ratio", "TELEMETRY_SAMPLE_RATIO", "fraction of the traces recorded, from 0 to 1", func(c *Config) flag.Value { return float64Var(&c.Telemetry.SampleRatio) }},
+	{"auth.disabled", "AUTH_DISABLED", "serve the API without authentication", func(c *Config) flag.Value { return boolVar(&c.Auth.Disabled) }},
+	{"auth.hs256_secret", "AUTH_HS256_SECRET", "secret of the HS256 tokens", func(c *Config) flag.Value { return stringVar(&c.Auth.HS256Secret) }},
+	{"auth.jwks_file", "AUTH_JWKS_FILE", "JWKS file of the keys of the RS256 and ES256 tokens", func(c *Config) flag.Value { return stringVar(&c.Auth.JWKSFile) }},
+	{"auth.issuer", "AUTH_ISSUER", "required iss claim of the tokens", func(c *Config) flag.Value { return stringVar(&c.Auth.Issuer) }},
+	{"auth.audience", "AUTH_AUDIENCE", "required aud claim of the tokens", func(c *Config) flag.Value { return stringVar(&c.Auth.Audience) }},
+	{"auth.leeway", "AUTH_LEEWAY", "clock skew tolerated when checking the expiry of the tokens", func(c *Config) flag.Value { return durationVar(&c.Auth.Leeway) }},
+}
+
+// Load builds the configuration from, in increasing order of precedence, Default, the file given with -config or
+// FileEnv, the environment variables and the flags in args, then validates it. The environment is read with
+// lookupEnv, usually os.LookupEnv.
+func Load(fs *flag.FlagSet, args []string, lookupEnv func(string) (string, bool)) (Config, Options, error) {
+	var opts Options
+
+	opts.File, _ = lookupEnv(FileEnv)
+	fs.StringVar(&opts.File, "config", opts.File, "YAML or TOML configuration file (env "+FileEnv+")")
+	fs.BoolVar(&opts.PrintConfig, "print-config", false, "print the configuration, with secrets redacted, and exit")
+
+	// the flags are recorded as they are parsed and applied once the file and the environment are
+	var scratch Config
+
+	flags := map[string]string{}
+
+	for _, s := range settings {
+		sCpy := s
+		_, isBool := s.value(&scratch).(*boolValue)
+
+		fs.Var(&recorder{isBool: isBool, set: func(v string) error {
+			if err := sCpy.value(&scratch).Set(v); err != nil {
+				return err
+			}
+
+			flags[sCpy.key] = v
+
+			return nil
+		}}, s.flagName(), fmt.Sprintf("%s (env %s)", s.usage, s.env))
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return Config{}, opts, err
+	}
+
+	config := Default()
+
+	if opts.File != "" {
+		if err := loadFile(opts.File, &config); err != nil {
+			return Config{}, opts, err
+		}
+	}
+
+	for _, s := range settings {
+		if v, ok := lookupEnv(s.env); ok {
+			if err := s.value(&config).Set(v); err != nil {
+				return Config{}, opts, fmt.Errorf("%w: %s=%q: %w", ErrInvalid, s.env, v, err)
+			}
+		}
+	}
+
+	for _, s := range settings {
+		if v, ok := flags[s.key]; ok {
+			_ = s.value(&config).Set(v) // already parsed successfully
+		}
+	}
+
+	return config, opts, config.Validate()
+}
+
+func loadFile(path string, config *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read configuration file: %w", err)
+	}
+
+	var (
+		decodeStrict func([]byte, any) error
+		marshal      func(any) ([]byte, error)
+		unmarshal    func([]byte, any) error
+	)
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		decodeStrict, marshal, unmarshal = decodeYAML, yaml.Marshal, yaml.Unmarshal
+	case ".toml":
+		decodeStrict, marshal, unmarshal = decodeTOML, toml.Marshal, toml.Unmarshal
+	default:
+		return fmt.Errorf("%w: unsupported configuration file extension %q, expected .yaml, .yml or .toml", ErrInvalid, ext)
+	}
+
+	// the file is checked as written first, so that the errors point to its lines
+	var scratch Config
+	if err := decodeStrict(data, &scratch); err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrInvalid, path, err)
+	}
+
+	data, err = withLinkDefaults(data, marshal, unmarshal)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrInvalid, path, err)
+	}
+
+	if err := unmarshal(data, config); err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrInvalid, path, err)
+	}
+
+	return nil
+}
+
+func decodeYAML(data []byte, v any) error {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+
+	if err := dec.Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	return nil
+}
+
+func decodeTOML(data []byte, v any) error {
+	dec := toml.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	return dec.Decode(v)
+}
+
+// withLinkDefaults completes the chain links of the document data with the photo settings of Default that they leave
+// unset, except the provider and its base URL. The decoders start each link from an empty PhotoConfig otherwise, so
+// that a chained provider would not be retried, cached nor validated like the top level one.
+func withLinkDefaults(data []byte, marshal func(any) ([]byte, error), unmarshal func([]byte, any) error) ([]byte, error) {
+	var doc map[string]any
+	if err := unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	photoDoc, _ := doc["photo"].(map[string]any)
+	if len(chainLinks(photoDoc)) == 0 {
+		return data, nil
+	}
+
+	defaultsData, err := marshal(Default().Photo)
+	if err != nil {
+		return nil, err
+	}
+
+	var defaults map[string]any
+	if err := unmarshal(defaultsData, &defaults); err != nil {
+		return nil, err
+	}
+
+	delete(defaults, "provider")
+	delete(defaults, "base_url")
+
+	completeLinks(photoDoc, defaults)
+
+	return marshal(doc)
+}
+
+func chainLinks(photoDoc map[string]any) []any {
+	chain, _ := photoDoc["chain"].(map[string]any)
+	links, _ := chain["links"].([]any)
+
+	return links
+}
+
+// completeLinks adds the defaults to the links of photoDoc, and to the links of the chains they nest.
+func completeLinks(photoDoc, defaults map[string]any) {
+	for _, l := range chainLinks(photoDoc) {
+		if link, ok := l.(map[string]any); ok {
+			addMissing(link, defaults)
+			completeLinks(link, defaults)
+		}
+	}
+}
+
+func addMissing(dst, src map[string]any) {
+	for key, value := range src {
+		existing, ok := dst[key]
+		if !ok {
+			dst[key] = value
+			continue
+		}
+
+		existingMap, isMap := existing.(map[string]any)
+		valueMap, isValueMap := value.(map[string]any)
+
+		if isMap && isValueMap {
+			addMissing(existingMap, valueMap)
+		}
+	}
+}
+
+// recorder is the flag.Value of a setting, see Load.
+type recorder struct {
+	isBool bool
+	set    func(string) error
+	value  string
+}
+
+func (r *recorder) Set(v string) error {
+	if err := r.set(v); err != nil {
+		return err
+	}
+
+	r.value = v
+
+	return nil
+}
+
+func (r *recorder) String() string {
+	if r == nil {
+		return ""
+	}
+
+	return r.value
+}
+
+func (r *recorder) IsBoolFlag() bool {
+	return r.isBool
+}
+
+type value[T any] struct {
+	p     *T
+	parse func(string) (T, error)
+}
+
+func (v *value[T]) Set(s string) error {
+	parsed, err := v.parse(s)
+	if err != nil {
+		return err
+	}
+
+	*v.p = parsed
+
+	return nil
+}
+
+func (v *value[T]) String() string {
+	if v == nil || v.p == nil {
+		return ""
+	}
+
+	return fmt.Sprint(*v.p)
+}
+
+type boolValue struct {
+	value[bool]
+}
+
+func (*boolValue) IsBoolFlag() bool {
+	return true
+}
+
+func stringVar(p *string) flag.Value {
+	return &value[string]{p: p, parse: func(s string) (string, error) { return s, nil }}
+}
+
+func boolVar(p *bool) flag.Value {
+	return &boolValue{value[bool]{p: p, parse: strconv.ParseBool}}
+}
+
+func intVar(p *int) flag.Value {
+	return &value[int]{p: p, parse: strconv.Atoi}
+}
+
+func int64Var(p *int64) flag.Value {
+	return &value[int64]{p: p, parse: func(s string) (int64, error) { return strconv.ParseInt(s, 10, 64) }}
+}
+
+func uint32Var(p *uint32) flag.Value {
+	return &value[uint32]{p: p, parse: func(s string) (uint32, error) {
+		v, err := strconv.ParseUint(s, 10, 32)
+		return uint32(v), err
+	}}
+}
+
+func uint64Var(p *uint64) flag.Value {
+	return &value[uint64]{p: p, parse: func(s string) (uint64, error) { return strconv.ParseUint(s, 10, 64) }}
+}
+
+func float64Var(p *float64) flag.Value {
+	return &value[float64]{p: p, parse: func(s string) (float64, error) { return strconv.ParseFloat(s, 64) }}
+}
+
+func durationVar(p *Duration) flag.Value {
+	return &value[Duration]{p: p, parse: func(s string) (Duration, error) {
+		d, err := time.ParseDuration(s)
+		return Duration(d), err
+	}}
+}
+
+// listVar parses comma separated values. An empty string is an empty list.
+func listVar(p *[]string) flag.Value {
+	return &value[[]string]{p: p, parse: func(s string) ([]string, error) {
+		if s == "" {
+			return []string{}, nil
+		}
+
+		items := strings.Split(s, ",")
+		for i := range items {
+			items[i] = strings.TrimSpace(items[i])
+		}
+
+		return items, nil
+	}}
+}
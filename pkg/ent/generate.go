@@ -1,3 +1,3 @@
 package ent
 
-//go:generate ent generate ./schema
+//go:generate ent generate --feature intercept,sql/versioned-migration ./schema
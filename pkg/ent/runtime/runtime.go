@@ -2,7 +2,43 @@
 
 package runtime
 
-// The schema-stitching logic is generated in github.com/PopescuStefanRadu/ent-demo/pkg/ent/runtime.go
+import (
+	"time"
+
+	"github.com/PopescuStefanRadu/ent-demo/pkg/ent/schema"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/ent/user"
+)
+
+// The init function reads all schema descriptors with runtime code
+// (default values, validators, hooks and policies) and stitches it
+// to their package variables.
+func init() {
+	userMixin := schema.User{}.Mixin()
+	userMixinHooks0 := userMixin[0].Hooks()
+	user.Hooks[0] = userMixinHooks0[0]
+	userMixinInters0 := userMixin[0].Interceptors()
+	user.Interceptors[0] = userMixinInters0[0]
+	userFields := schema.User{}.Fields()
+	_ = userFields
+	// userDescDogPhotoURL is the schema descriptor for dog_photo_url field.
+	userDescDogPhotoURL := userFields[3].Descriptor()
+	// user.DefaultDogPhotoURL holds the default value on creation for the dog_photo_url field.
+	user.DefaultDogPhotoURL = userDescDogPhotoURL.Default.(string)
+	// userDescCreatedAt is the schema descriptor for created_at field.
+	userDescCreatedAt := userFields[4].Descriptor()
+	// user.DefaultCreatedAt holds the default value on creation for the created_at field.
+	user.DefaultCreatedAt = userDescCreatedAt.Default.(func() time.Time)
+	// userDescUpdatedAt is the schema descriptor for updated_at field.
+	userDescUpdatedAt := userFields[5].Descriptor()
+	// user.DefaultUpdatedAt holds the default value on creation for the updated_at field.
+	user.DefaultUpdatedAt = userDescUpdatedAt.Default.(func() time.Time)
+	// user.UpdateDefaultUpdatedAt holds the default value on update for the updated_at field.
+	user.UpdateDefaultUpdatedAt = userDescUpdatedAt.UpdateDefault.(func() time.Time)
+	// userDescVersion is the schema descriptor for version field.
+	userDescVersion := userFields[6].Descriptor()
+	// user.DefaultVersion holds the default value on creation for the version field.
+	user.DefaultVersion = userDescVersion.Default.(int)
+}
 
 const (
 	Version = "v0.12.5"                                         // Version of ent codegen.
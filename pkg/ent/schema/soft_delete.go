@@ -0,0 +1,93 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"entgo.io/ent"
+	"entgo.io/ent/dialect/sql"
+	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/mixin"
+	gen "github.com/PopescuStefanRadu/ent-demo/pkg/ent"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/ent/hook"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/ent/intercept"
+)
+
+// SoftDeleteMixin adds a deleted_at field to a schema. Queries, updates and deletes ignore the rows that have it set,
+// and deletes set it instead of removing the rows. Use SkipSoftDelete to operate on all rows and to delete for real.
+type SoftDeleteMixin struct {
+	mixin.Schema
+}
+
+type softDeleteKey struct{}
+
+// SkipSoftDelete returns a context that disables the soft delete behaviour of SoftDeleteMixin.
+func SkipSoftDelete(parent context.Context) context.Context {
+	return context.WithValue(parent, softDeleteKey{}, true)
+}
+
+func skipSoftDelete(ctx context.Context) bool {
+	skip, _ := ctx.Value(softDeleteKey{}).(bool)
+	return skip
+}
+
+// Fields of the SoftDeleteMixin.
+func (SoftDeleteMixin) Fields() []ent.Field {
+	return []ent.Field{
+		field.Time("deleted_at").Optional().Nillable(),
+	}
+}
+
+// Interceptors of the SoftDeleteMixin.
+func (d SoftDeleteMixin) Interceptors() []ent.Interceptor {
+	return []ent.Interceptor{
+		intercept.TraverseFunc(func(ctx context.Context, q intercept.Query) error {
+			if !skipSoftDelete(ctx) {
+				d.excludeDeleted(q)
+			}
+
+			return nil
+		}),
+	}
+}
+
+// Hooks of the SoftDeleteMixin.
+func (d SoftDeleteMixin) Hooks() []ent.Hook {
+	return []ent.Hook{
+		hook.On(func(next ent.Mutator) ent.Mutator {
+			return ent.MutateFunc(func(ctx context.Context, m ent.Mutation) (ent.Value, error) {
+				if skipSoftDelete(ctx) {
+					return next.Mutate(ctx, m)
+				}
+
+				mx, ok := m.(interface {
+					SetOp(op ent.Op)
+					Client() *gen.Client
+					SetDeletedAt(t time.Time)
+					WhereP(ps ...func(*sql.Selector))
+				})
+				if !ok {
+					return nil, fmt.Errorf("unexpected mutation type %T", m)
+				}
+
+				d.excludeDeleted(mx)
+
+				if !m.Op().Is(ent.OpDelete | ent.OpDeleteOne) {
+					return next.Mutate(ctx, m)
+				}
+
+				mx.SetOp(ent.OpUpdate)
+				mx.SetDeletedAt(Now())
+
+				return mx.Client().Mutate(ctx, m)
+			})
+		}, ent.OpUpdate|ent.OpUpdateOne|ent.OpDelete|ent.OpDeleteOne),
+	}
+}
+
+func (d SoftDeleteMixin) excludeDeleted(w interface {
+	WhereP(ps ...func(*sql.Selector))
+}) {
+	w.WhereP(sql.FieldIsNull(d.Fields()[0].Descriptor().Name))
+}
@@ -4,7 +4,9 @@ import (
 	"time"
 
 	"entgo.io/ent"
+	"entgo.io/ent/dialect/entsql"
 	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/index"
 )
 
 // User holds the schema definition for the User entity.
@@ -16,14 +18,34 @@ func Now() time.Time {
 	return time.Now().In(time.UTC)
 }
 
+// Mixin of the User.
+func (User) Mixin() []ent.Mixin {
+	return []ent.Mixin{
+		SoftDeleteMixin{},
+	}
+}
+
 // Fields of the User.
 func (User) Fields() []ent.Field {
 	return []ent.Field{
 		field.Int("id"),
 		field.String("username"),
-		field.String("email").Unique(),
+		field.String("email"),
+		// dog_photo_url is chosen when the user is created and only changes when explicitly refreshed.
+		field.String("dog_photo_url").Default(""),
 		field.Time("created_at").Default(Now),
 		field.Time("updated_at").Default(Now).UpdateDefault(Now),
+		// version is incremented by every update and is used for optimistic concurrency control.
+		field.Int("version").Default(1),
+	}
+}
+
+// Indexes of the User.
+func (User) Indexes() []ent.Index {
+	return []ent.Index{
+		// the email of a soft deleted user can be taken by a new one. MySQL has no partial indexes and ignores the
+		// predicate, so there the email is only freed when the user is purged.
+		index.Fields("email").Unique().StorageKey("users_email_key").Annotations(entsql.IndexWhere("deleted_at IS NULL")),
 	}
 }
 
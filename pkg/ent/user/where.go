@@ -54,6 +54,11 @@ func IDLTE(id int) predicate.User {
 	return predicate.User(sql.FieldLTE(FieldID, id))
 }
 
+// DeletedAt applies equality check predicate on the "deleted_at" field. It's identical to DeletedAtEQ.
+func DeletedAt(v time.Time) predicate.User {
+	return predicate.User(sql.FieldEQ(FieldDeletedAt, v))
+}
+
 // Username applies equality check predicate on the "username" field. It's identical to UsernameEQ.
 func Username(v string) predicate.User {
 	return predicate.User(sql.FieldEQ(FieldUsername, v))
@@ -64,6 +69,11 @@ func Email(v string) predicate.User {
 	return predicate.User(sql.FieldEQ(FieldEmail, v))
 }
 
+// DogPhotoURL applies equality check predicate on the "dog_photo_url" field. It's identical to DogPhotoURLEQ.
+func DogPhotoURL(v string) predicate.User {
+	return predicate.User(sql.FieldEQ(FieldDogPhotoURL, v))
+}
+
 // CreatedAt applies equality check predicate on the "created_at" field. It's identical to CreatedAtEQ.
 func CreatedAt(v time.Time) predicate.User {
 	return predicate.User(sql.FieldEQ(FieldCreatedAt, v))
@@ -74,6 +84,61 @@ func UpdatedAt(v time.Time) predicate.User {
 	return predicate.User(sql.FieldEQ(FieldUpdatedAt, v))
 }
 
+// Version applies equality check predicate on the "version" field. It's identical to VersionEQ.
+func Version(v int) predicate.User {
+	return predicate.User(sql.FieldEQ(FieldVersion, v))
+}
+
+// DeletedAtEQ applies the EQ predicate on the "deleted_at" field.
+func DeletedAtEQ(v time.Time) predicate.User {
+	return predicate.User(sql.FieldEQ(FieldDeletedAt, v))
+}
+
+// DeletedAtNEQ applies the NEQ predicate on the "deleted_at" field.
+func DeletedAtNEQ(v time.Time) predicate.User {
+	return predicate.User(sql.FieldNEQ(FieldDeletedAt, v))
+}
+
+// DeletedAtIn applies the In predicate on the "deleted_at" field.
+func DeletedAtIn(vs ...time.Time) predicate.User {
+	return predicate.User(sql.FieldIn(FieldDeletedAt, vs...))
+}
+
+// DeletedAtNotIn applies the NotIn predicate on the "deleted_at" field.
+func DeletedAtNotIn(vs ...time.Time) predicate.User {
+	return predicate.User(sql.FieldNotIn(FieldDeletedAt, vs...))
+}
+
+// DeletedAtGT applies the GT predicate on the "deleted_at" field.
+func DeletedAtGT(v time.Time) predicate.User {
+	return predicate.User(sql.FieldGT(FieldDeletedAt, v))
+}
+
+// DeletedAtGTE applies the GTE predicate on the "deleted_at" field.
+func DeletedAtGTE(v time.Time) predicate.User {
+	return predicate.User(sql.FieldGTE(FieldDeletedAt, v))
+}
+
+// DeletedAtLT applies the LT predicate on the "deleted_at" field.
+func DeletedAtLT(v time.Time) predicate.User {
+	return predicate.User(sql.FieldLT(FieldDeletedAt, v))
+}
+
+// DeletedAtLTE applies the LTE predicate on the "deleted_at" field.
+func DeletedAtLTE(v time.Time) predicate.User {
+	return predicate.User(sql.FieldLTE(FieldDeletedAt, v))
+}
+
+// DeletedAtIsNil applies the IsNil predicate on the "deleted_at" field.
+func DeletedAtIsNil() predicate.User {
+	return predicate.User(sql.FieldIsNull(FieldDeletedAt))
+}
+
+// DeletedAtNotNil applies the NotNil predicate on the "deleted_at" field.
+func DeletedAtNotNil() predicate.User {
+	return predicate.User(sql.FieldNotNull(FieldDeletedAt))
+}
+
 // UsernameEQ applies the EQ predicate on the "username" field.
 func UsernameEQ(v string) predicate.User {
 	return predicate.User(sql.FieldEQ(FieldUsername, v))
@@ -204,6 +269,71 @@ func EmailContainsFold(v string) predicate.User {
 	return predicate.User(sql.FieldContainsFold(FieldEmail, v))
 }
 
+// DogPhotoURLEQ applies the EQ predicate on the "dog_photo_url" field.
+func DogPhotoURLEQ(v string) predicate.User {
+	return predicate.User(sql.FieldEQ(FieldDogPhotoURL, v))
+}
+
+// DogPhotoURLNEQ applies the NEQ predicate on the "dog_photo_url" field.
+func DogPhotoURLNEQ(v string) predicate.User {
+	return predicate.User(sql.FieldNEQ(FieldDogPhotoURL, v))
+}
+
+// DogPhotoURLIn applies the In predicate on the "dog_photo_url" field.
+func DogPhotoURLIn(vs ...string) predicate.User {
+	return predicate.User(sql.FieldIn(FieldDogPhotoURL, vs...))
+}
+
+// DogPhotoURLNotIn applies the NotIn predicate on the "dog_photo_url" field.
+func DogPhotoURLNotIn(vs ...string) predicate.User {
+	return predicate.User(sql.FieldNotIn(FieldDogPhotoURL, vs...))
+}
+
+// DogPhotoURLGT applies the GT predicate on the "dog_photo_url" field.
+func DogPhotoURLGT(v string) predicate.User {
+	return predicate.User(sql.FieldGT(FieldDogPhotoURL, v))
+}
+
+// DogPhotoURLGTE applies the GTE predicate on the "dog_photo_url" field.
+func DogPhotoURLGTE(v string) predicate.User {
+	return predicate.User(sql.FieldGTE(FieldDogPhotoURL, v))
+}
+
+// DogPhotoURLLT applies the LT predicate on the "dog_photo_url" field.
+func DogPhotoURLLT(v string) predicate.User {
+	return predicate.User(sql.FieldLT(FieldDogPhotoURL, v))
+}
+
+// DogPhotoURLLTE applies the LTE predicate on the "dog_photo_url" field.
+func DogPhotoURLLTE(v string) predicate.User {
+	return predicate.User(sql.FieldLTE(FieldDogPhotoURL, v))
+}
+
+// DogPhotoURLContains applies the Contains predicate on the "dog_photo_url" field.
+func DogPhotoURLContains(v string) predicate.User {
+	return predicate.User(sql.FieldContains(FieldDogPhotoURL, v))
+}
+
+// DogPhotoURLHasPrefix applies the HasPrefix predicate on the "dog_photo_url" field.
+func DogPhotoURLHasPrefix(v string) predicate.User {
+	return predicate.User(sql.FieldHasPrefix(FieldDogPhotoURL, v))
+}
+
+// DogPhotoURLHasSuffix applies the HasSuffix predicate on the "dog_photo_url" field.
+func DogPhotoURLHasSuffix(v string) predicate.User {
+	return predicate.User(sql.FieldHasSuffix(FieldDogPhotoURL, v))
+}
+
+// DogPhotoURLEqualFold applies the EqualFold predicate on the "dog_photo_url" field.
+func DogPhotoURLEqualFold(v string) predicate.User {
+	return predicate.User(sql.FieldEqualFold(FieldDogPhotoURL, v))
+}
+
+// DogPhotoURLContainsFold applies the ContainsFold predicate on the "dog_photo_url" field.
+func DogPhotoURLContainsFold(v string) predicate.User {
+	return predicate.User(sql.FieldContainsFold(FieldDogPhotoURL, v))
+}
+
 // CreatedAtEQ applies the EQ predicate on the "created_at" field.
 func CreatedAtEQ(v time.Time) predicate.User {
 	return predicate.User(sql.FieldEQ(FieldCreatedAt, v))
@@ -284,6 +414,46 @@ func UpdatedAtLTE(v time.Time) predicate.User {
 	return predicate.User(sql.FieldLTE(FieldUpdatedAt, v))
 }
 
+// VersionEQ applies the EQ predicate on the "version" field.
+func VersionEQ(v int) predicate.User {
+	return predicate.User(sql.FieldEQ(FieldVersion, v))
+}
+
+// VersionNEQ applies the NEQ predicate on the "version" field.
+func VersionNEQ(v int) predicate.User {
+	return predicate.User(sql.FieldNEQ(FieldVersion, v))
+}
+
+// VersionIn applies the In predicate on the "version" field.
+func VersionIn(vs ...int) predicate.User {
+	return predicate.User(sql.FieldIn(FieldVersion, vs...))
+}
+
+// VersionNotIn applies the NotIn predicate on the "version" field.
+func VersionNotIn(vs ...int) predicate.User {
+	return predicate.User(sql.FieldNotIn(FieldVersion, vs...))
+}
+
+// VersionGT applies the GT predicate on the "version" field.
+func VersionGT(v int) predicate.User {
+	return predicate.User(sql.FieldGT(FieldVersion, v))
+}
+
+// VersionGTE applies the GTE predicate on the "version" field.
+func VersionGTE(v int) predicate.User {
+	return predicate.User(sql.FieldGTE(FieldVersion, v))
+}
+
+// VersionLT applies the LT predicate on the "version" field.
+func VersionLT(v int) predicate.User {
+	return predicate.User(sql.FieldLT(FieldVersion, v))
+}
+
+// VersionLTE applies the LTE predicate on the "version" field.
+func VersionLTE(v int) predicate.User {
+	return predicate.User(sql.FieldLTE(FieldVersion, v))
+}
+
 // And groups predicates with the AND operator between them.
 func And(predicates ...predicate.User) predicate.User {
 	return predicate.User(sql.AndPredicates(predicates...))
@@ -0,0 +1,117 @@
+package entwrap
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/PopescuStefanRadu/ent-demo/pkg/ent"
+	businessUser "github.com/PopescuStefanRadu/ent-demo/pkg/user"
+)
+
+// cursor is the decoded form of the opaque pagination token handed out as businessUser.Page.NextCursor. It holds the
+// sort key values of the last user of a page, and the sort they belong to.
+type cursor struct {
+	Sort      string     `json:"sort"`
+	ID        int        `json:"id"`
+	Username  *string    `json:"username,omitempty"`
+	Email     *string    `json:"email,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+func newCursor(sort []businessUser.SortKey, u *ent.User) cursor {
+	c := cursor{Sort: sortSignature(sort), ID: u.ID}
+
+	for _, key := range sort {
+		switch key.Field {
+		case businessUser.SortByID:
+		case businessUser.SortByUsername:
+			c.Username = &u.Username
+		case businessUser.SortByEmail:
+			c.Email = &u.Email
+		case businessUser.SortByCreatedAt:
+			c.CreatedAt = &u.CreatedAt
+		case businessUser.SortByUpdatedAt:
+			c.UpdatedAt = &u.UpdatedAt
+		}
+	}
+
+	return c
+}
+
+// value returns the cursor value of a sort field, or nil if the cursor does not hold it.
+func (c cursor) value(field businessUser.SortField) any {
+	switch field {
+	case businessUser.SortByID:
+		return c.ID
+	case businessUser.SortByUsername:
+		if c.Username != nil {
+			return *c.Username
+		}
+	case businessUser.SortByEmail:
+		if c.Email != nil {
+			return *c.Email
+		}
+	case businessUser.SortByCreatedAt:
+		if c.CreatedAt != nil {
+			return c.CreatedAt.UTC()
+		}
+	case businessUser.SortByUpdatedAt:
+		if c.UpdatedAt != nil {
+			return c.UpdatedAt.UTC()
+		}
+	}
+
+	return nil
+}
+
+func sortSignature(sort []businessUser.SortKey) string {
+	keys := make([]string, len(sort))
+
+	for i, key := range sort {
+		keys[i] = string(key.Field)
+		if key.Desc {
+			keys[i] = "-" + keys[i]
+		}
+	}
+
+	return strings.Join(keys, ",")
+}
+
+func encodeCursor(c cursor) (string, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("could not encode cursor: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// decodeCursor decodes a token and checks that it was issued for the given sort.
+func decodeCursor(s string, sort []businessUser.SortKey) (cursor, error) {
+	var c cursor
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, fmt.Errorf("%w: malformed cursor: %w", businessUser.ErrInvalidInput, err)
+	}
+
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, fmt.Errorf("%w: malformed cursor: %w", businessUser.ErrInvalidInput, err)
+	}
+
+	if c.Sort != sortSignature(sort) {
+		return c, fmt.Errorf("%w: cursor was issued for a different sort", businessUser.ErrInvalidInput)
+	}
+
+	for _, key := range sort {
+		if c.value(key.Field) == nil {
+			return c, fmt.Errorf("%w: cursor has no value for %s", businessUser.ErrInvalidInput, key.Field)
+		}
+	}
+
+	return c, nil
+}
@@ -1,3 +1,6 @@
 // Package entwrap wraps the ent persistence layer so that it
 // fits the interfaces required by the business layer.
 package entwrap
+
+// The generated runtime package registers the defaults, hooks and interceptors of the schema.
+import _ "github.com/PopescuStefanRadu/ent-demo/pkg/ent/runtime"
@@ -0,0 +1,87 @@
+package entwrap
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+
+	"entgo.io/ent/dialect"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+var ErrInvalidDSN = errors.New("invalid dsn")
+
+// driver holds what is specific to a database. The dialect names of ent double as the names of the registered
+// database/sql drivers.
+type driver struct {
+	// validateDSN checks that the dsn is well-formed and has the options ent relies on.
+	validateDSN func(dsn string) error
+	// translateError maps the errors of the driver to business errors. It returns nil for the errors it does not know.
+	translateError func(err error) error
+	// migrationsDir is the subdirectory of MigrationsPath holding the migrations of the dialect.
+	migrationsDir string
+	// dbSystem identifies the database in the spans of TracingDriver.
+	dbSystem attribute.KeyValue
+	// lockMigrations takes a lock that serializes the migrators of the database until unlock is called, on the same
+	// connection. It is nil for SQLite, whose migrations lock the whole database while they are applied.
+	lockMigrations func(ctx context.Context, conn *sql.Conn) (unlock func(context.Context) error, err error)
+}
+
+//nolint:gochecknoglobals
+var drivers = map[string]driver{
+	dialect.SQLite: {
+		validateDSN: validateSQLiteDSN, translateError: translateSQLiteError, migrationsDir: "sqlite",
+		dbSystem: semconv.DBSystemSqlite,
+	},
+	dialect.Postgres: {
+		validateDSN: validatePostgresDSN, translateError: translatePostgresError, migrationsDir: "postgres",
+		dbSystem: semconv.DBSystemPostgreSQL, lockMigrations: lockPostgresMigrations,
+	},
+	dialect.MySQL: {
+		validateDSN: validateMySQLDSN, translateError: translateMySQLError, migrationsDir: "mysql",
+		dbSystem: semconv.DBSystemMySQL, lockMigrations: lockMySQLMigrations,
+	},
+}
+
+// Dialects lists the supported dialects.
+func Dialects() []string {
+	names := make([]string, 0, len(drivers))
+	for name := range drivers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// OpenDB validates the dsn and opens a database of the given dialect.
+func OpenDB(dialectName, dsn string) (*sql.DB, error) {
+	d, err := lookupDriver(dialectName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := d.validateDSN(dsn); err != nil {
+		return nil, fmt.Errorf("%w for %s: %w", ErrInvalidDSN, dialectName, err)
+	}
+
+	db, err := sql.Open(dialectName, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("could not open db: %w", err)
+	}
+
+	return db, nil
+}
+
+func lookupDriver(dialectName string) (driver, error) {
+	d, ok := drivers[dialectName]
+	if !ok {
+		return driver{}, fmt.Errorf("unsupported dialect %q, expected one of %v", dialectName, Dialects())
+	}
+
+	return d, nil
+}
@@ -0,0 +1,74 @@
+package entwrap
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	businessUser "github.com/PopescuStefanRadu/ent-demo/pkg/user"
+	"github.com/go-sql-driver/mysql"
+)
+
+// MySQL error numbers, see https://dev.mysql.com/doc/mysql-errors/8.0/en/server-error-reference.html.
+const (
+	mysqlTooManyConnections = 1040
+	mysqlLockWaitTimeout    = 1205
+	mysqlDeadlock           = 1213
+	mysqlOutOfRange         = 1264
+	mysqlDataTooLong        = 1406
+)
+
+// validateMySQLDSN requires parseTime, without which the time fields of ent cannot be scanned.
+func validateMySQLDSN(dsn string) error {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return err
+	}
+
+	if !cfg.ParseTime {
+		return errors.New(`time values must be parsed with "parseTime=true"`)
+	}
+
+	return nil
+}
+
+func translateMySQLError(err error) error {
+	if errors.Is(err, mysql.ErrInvalidConn) {
+		return fmt.Errorf("%w: %w", businessUser.ErrDependencyUnavailable, err)
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return nil
+	}
+
+	switch mysqlErr.Number {
+	case mysqlDeadlock:
+		return fmt.Errorf("%w: %w", businessUser.ErrConflict, err)
+	case mysqlTooManyConnections, mysqlLockWaitTimeout:
+		return fmt.Errorf("%w: %w", businessUser.ErrDependencyUnavailable, err)
+	case mysqlOutOfRange, mysqlDataTooLong:
+		return fmt.Errorf("%w: %w", businessUser.ErrInvalidInput, err)
+	default:
+		return nil
+	}
+}
+
+// lockMySQLMigrations takes a named lock, waiting for it without timeout. MySQL commits DDL statements implicitly, so
+// the transaction of a migration does not keep another migrator from applying it too.
+func lockMySQLMigrations(ctx context.Context, conn *sql.Conn) (func(context.Context) error, error) {
+	var locked sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, -1)", MigrationsTable).Scan(&locked); err != nil {
+		return nil, err
+	}
+
+	if locked.Int64 != 1 {
+		return nil, fmt.Errorf("could not get lock %q", MigrationsTable)
+	}
+
+	return func(ctx context.Context) error {
+		var released sql.NullInt64
+		return conn.QueryRowContext(ctx, "SELECT RELEASE_LOCK(?)", MigrationsTable).Scan(&released)
+	}, nil
+}
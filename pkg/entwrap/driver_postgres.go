@@ -0,0 +1,48 @@
+package entwrap
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	businessUser "github.com/PopescuStefanRadu/ent-demo/pkg/user"
+	"github.com/lib/pq"
+)
+
+func validatePostgresDSN(dsn string) error {
+	_, err := pq.NewConnector(dsn)
+	return err
+}
+
+// translatePostgresError classifies errors by their SQLSTATE, see https://www.postgresql.org/docs/current/errcodes-appendix.html.
+func translatePostgresError(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return nil
+	}
+
+	switch {
+	case pqErr.Code == "40001", pqErr.Code == "40P01": // serialization_failure, deadlock_detected
+		return fmt.Errorf("%w: %w", businessUser.ErrConflict, err)
+	case pqErr.Code.Class() == "08", pqErr.Code.Class() == "53", pqErr.Code.Class() == "57", // connection, resources, operator
+		pqErr.Code == "55P03": // lock_not_available
+		return fmt.Errorf("%w: %w", businessUser.ErrDependencyUnavailable, err)
+	case pqErr.Code.Class() == "22": // data exception, e.g. a value too long for its column
+		return fmt.Errorf("%w: %w", businessUser.ErrInvalidInput, err)
+	default:
+		return nil
+	}
+}
+
+// lockPostgresMigrations takes a session level advisory lock, keyed by the name of MigrationsTable.
+func lockPostgresMigrations(ctx context.Context, conn *sql.Conn) (func(context.Context) error, error) {
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock(hashtext($1))", MigrationsTable); err != nil {
+		return nil, err
+	}
+
+	return func(ctx context.Context) error {
+		_, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock(hashtext($1))", MigrationsTable)
+		return err
+	}, nil
+}
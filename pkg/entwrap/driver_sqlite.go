@@ -0,0 +1,49 @@
+package entwrap
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	businessUser "github.com/PopescuStefanRadu/ent-demo/pkg/user"
+	"github.com/mattn/go-sqlite3"
+)
+
+// validateSQLiteDSN requires foreign keys to be enforced, as SQLite does not do it by default.
+func validateSQLiteDSN(dsn string) error {
+	path, query, _ := strings.Cut(dsn, "?")
+	if path == "" {
+		return errors.New("missing database file")
+	}
+
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range []string{"_fk", "_foreign_keys"} {
+		switch strings.ToLower(params.Get(key)) {
+		case "1", "true", "on", "yes":
+			return nil
+		}
+	}
+
+	return errors.New(`foreign keys must be enabled with "_fk=1"`)
+}
+
+func translateSQLiteError(err error) error {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return nil
+	}
+
+	switch sqliteErr.Code { //nolint:exhaustive
+	case sqlite3.ErrBusy, sqlite3.ErrLocked:
+		return fmt.Errorf("%w: %w", businessUser.ErrDependencyUnavailable, err)
+	case sqlite3.ErrTooBig:
+		return fmt.Errorf("%w: %w", businessUser.ErrInvalidInput, err)
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,44 @@
+package entwrap
+
+import (
+	sqldriver "database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/PopescuStefanRadu/ent-demo/pkg/ent"
+	businessUser "github.com/PopescuStefanRadu/ent-demo/pkg/user"
+)
+
+// translateError wraps ent and driver errors into the matching business error, keeping the original as cause.
+func translateError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case ent.IsNotFound(err):
+		return fmt.Errorf("%w: %w", businessUser.ErrNotFound, err)
+	case ent.IsConstraintError(err) && isEmailTaken(err):
+		return fmt.Errorf("%w: %w", businessUser.ErrEmailTaken, err)
+	case ent.IsConstraintError(err):
+		return fmt.Errorf("%w: %w", businessUser.ErrConflict, err)
+	case ent.IsValidationError(err):
+		return fmt.Errorf("%w: %w", businessUser.ErrInvalidInput, err)
+	case errors.Is(err, sqldriver.ErrBadConn):
+		return fmt.Errorf("%w: %w", businessUser.ErrDependencyUnavailable, err)
+	}
+
+	for _, d := range drivers {
+		if translated := d.translateError(err); translated != nil {
+			return translated
+		}
+	}
+
+	return err
+}
+
+// isEmailTaken tells whether a constraint error violates the unique index of the email, which the drivers name by the
+// index, or by the column for SQLite.
+func isEmailTaken(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "users_email_key") || strings.Contains(msg, "users.email")
+}
@@ -0,0 +1,112 @@
+package entwrap
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"entgo.io/ent/dialect"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+//nolint:gochecknoglobals
+var (
+	queriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "entdemo",
+		Subsystem: "db",
+		Name:      "queries_total",
+		Help:      "Queries made by ent, by dialect, operation (exec or query) and outcome (success or error).",
+	}, []string{"dialect", "operation", "outcome"})
+
+	queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "entdemo",
+		Subsystem: "db",
+		Name:      "query_duration_seconds",
+		Help:      "Duration of the queries made by ent, by dialect and operation (exec or query).",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14), //nolint:gomnd
+	}, []string{"dialect", "operation"})
+)
+
+// MetricsDriver counts the queries made through the wrapped driver, including the ones of transactions, and measures
+// their duration.
+type MetricsDriver struct {
+	dialect.Driver
+}
+
+// NewMetricsDriver wraps drv, usually a TracingDriver. The metrics are registered with the default registry of
+// prometheus.
+func NewMetricsDriver(drv dialect.Driver) *MetricsDriver {
+	return &MetricsDriver{Driver: drv}
+}
+
+func (d *MetricsDriver) Exec(ctx context.Context, query string, args, v any) error {
+	return d.observe("exec", func() error {
+		return d.Driver.Exec(ctx, query, args, v)
+	})
+}
+
+func (d *MetricsDriver) Query(ctx context.Context, query string, args, v any) error {
+	return d.observe("query", func() error {
+		return d.Driver.Query(ctx, query, args, v)
+	})
+}
+
+func (d *MetricsDriver) Tx(ctx context.Context) (dialect.Tx, error) {
+	tx, err := d.Driver.Tx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &metricsTx{Tx: tx, driver: d}, nil
+}
+
+// BeginTx is supported when the wrapped driver supports it, like the one of entsql.
+func (d *MetricsDriver) BeginTx(ctx context.Context, opts *sql.TxOptions) (dialect.Tx, error) {
+	drv, ok := d.Driver.(interface {
+		BeginTx(context.Context, *sql.TxOptions) (dialect.Tx, error)
+	})
+	if !ok {
+		return nil, errors.New("Driver.BeginTx is not supported")
+	}
+
+	tx, err := drv.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &metricsTx{Tx: tx, driver: d}, nil
+}
+
+func (d *MetricsDriver) observe(operation string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
+	}
+
+	queryDuration.WithLabelValues(d.Dialect(), operation).Observe(time.Since(start).Seconds())
+	queriesTotal.WithLabelValues(d.Dialect(), operation, outcome).Inc()
+
+	return err
+}
+
+type metricsTx struct {
+	dialect.Tx
+	driver *MetricsDriver
+}
+
+func (t *metricsTx) Exec(ctx context.Context, query string, args, v any) error {
+	return t.driver.observe("exec", func() error {
+		return t.Tx.Exec(ctx, query, args, v)
+	})
+}
+
+func (t *metricsTx) Query(ctx context.Context, query string, args, v any) error {
+	return t.driver.observe("query", func() error {
+		return t.Tx.Query(ctx, query, args, v)
+	})
+}
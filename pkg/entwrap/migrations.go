@@ -0,0 +1,59 @@
+package entwrap
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+
+	"ariga.io/atlas/sql/sqltool"
+	entsql "entgo.io/ent/dialect/sql"
+	"entgo.io/ent/dialect/sql/schema"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/ent/migrate"
+)
+
+// MigrationsPath is the directory of the migration files, relative to the root of the repository. It holds one
+// subdirectory per dialect.
+const MigrationsPath = "pkg/entwrap/migrations"
+
+//go:embed migrations
+var migrations embed.FS
+
+// MigrationsDir returns the migration files of a dialect that are embedded in the binary.
+func MigrationsDir(dialectName string) (fs.FS, error) {
+	d, err := lookupDriver(dialectName)
+	if err != nil {
+		return nil, err
+	}
+
+	return fs.Sub(migrations, "migrations/"+d.migrationsDir)
+}
+
+// NewMigration writes the up and down files of a migration that brings the schema defined by the migrations already
+// in MigrationsPath to the ent schema. The changes are computed by replaying the migrations on the dev database, which
+// must be empty and of the given dialect.
+func NewMigration(ctx context.Context, dialectName, devDSN, name string) error {
+	d, err := lookupDriver(dialectName)
+	if err != nil {
+		return err
+	}
+
+	migrationDir, err := sqltool.NewGolangMigrateDir(MigrationsPath + "/" + d.migrationsDir)
+	if err != nil {
+		return fmt.Errorf("could not open migration directory: %w", err)
+	}
+
+	db, err := OpenDB(dialectName, devDSN)
+	if err != nil {
+		return fmt.Errorf("could not open dev db: %w", err)
+	}
+	defer db.Close()
+
+	return migrate.NewSchema(entsql.OpenDB(dialectName, db)).NamedDiff(ctx, name,
+		schema.WithDir(migrationDir),
+		schema.WithMigrationMode(schema.ModeReplay),
+		schema.WithFormatter(sqltool.GolangMigrateFormatter),
+		schema.WithDropColumn(true),
+		schema.WithDropIndex(true),
+	)
+}
@@ -0,0 +1,2 @@
+-- modify "users" table
+ALTER TABLE `users` ADD COLUMN `dog_photo_url` text NOT NULL DEFAULT '';
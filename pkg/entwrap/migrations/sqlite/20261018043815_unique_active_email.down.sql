@@ -0,0 +1,4 @@
+-- reverse: create index "users_email_key" to table: "users"
+DROP INDEX `users_email_key`;
+-- reverse: drop index "users_email_key" from table: "users"
+CREATE UNIQUE INDEX `users_email_key` ON `users` (`email`);
@@ -0,0 +1,4 @@
+-- drop index "users_email_key" from table: "users"
+DROP INDEX `users_email_key`;
+-- create index "users_email_key" to table: "users"
+CREATE UNIQUE INDEX `users_email_key` ON `users` (`email`) WHERE deleted_at IS NULL;
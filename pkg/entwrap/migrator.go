@@ -1,25 +1,408 @@
 package entwrap
 
 import (
-	"bytes"
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
 
-	"github.com/PopescuStefanRadu/ent-demo/pkg/ent"
+	atlasmigrate "ariga.io/atlas/sql/migrate"
+	entsql "entgo.io/ent/dialect/sql"
 	"github.com/rs/zerolog"
 )
 
+// MigrationsTable records the versions of the applied migrations.
+const MigrationsTable = "schema_migrations"
+
+var (
+	ErrSchemaOutdated     = errors.New("database schema is not at the expected version")
+	ErrUnknownMigration   = errors.New("database has migrations that are unknown to this version of the application")
+	ErrInvalidMigrationFS = errors.New("invalid migration directory")
+	ErrChecksumMismatch   = errors.New("migration files do not match " + atlasmigrate.HashFileName)
+)
+
+// Migration is a pair of <version>_<name>.up.sql and <version>_<name>.down.sql files, as written by NewMigration.
+type Migration struct {
+	Version string
+	Name    string
+	up      string
+	down    string
+}
+
+// MigrationStatus compares the migrations of the directory with the ones applied to the database.
+type MigrationStatus struct {
+	// Applied lists the applied migrations, oldest first.
+	Applied []Migration
+	// Pending lists the migrations that are yet to be applied, oldest first.
+	Pending []Migration
+	// Unknown lists the versions that were applied to the database but are not in the directory.
+	Unknown []string
+}
+
+// Current is the version of the last applied migration, or empty if none was applied.
+func (s *MigrationStatus) Current() string {
+	if len(s.Applied) == 0 {
+		return ""
+	}
+
+	return s.Applied[len(s.Applied)-1].Version
+}
+
+// Migrator applies the versioned migrations of Dir to DB. Each migration runs in its own transaction, together with
+// the update of MigrationsTable. Up and Down check the files against the atlas.sum file of Dir, and hold a lock on
+// the database, so that migrators started together, e.g. by several instances, apply each migration once.
 type Migrator struct {
-	Ent    *ent.Client
-	Logger zerolog.Logger
+	DB      *sql.DB
+	Dialect string
+	Dir     fs.FS
+	Logger  zerolog.Logger
 }
 
+// Migrate applies all the pending migrations.
 func (m Migrator) Migrate(ctx context.Context) error {
-	buffer := &bytes.Buffer{}
-	if err := m.Ent.Schema.WriteTo(ctx, buffer); err != nil {
+	_, err := m.Up(ctx, 0)
+	return err
+}
+
+// CheckVersion fails with ErrSchemaOutdated if there are pending migrations, and with ErrUnknownMigration if the
+// database was migrated by a newer version of the application.
+func (m Migrator) CheckVersion(ctx context.Context) error {
+	status, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(status.Unknown) > 0 {
+		return fmt.Errorf("%w: %s", ErrUnknownMigration, strings.Join(status.Unknown, ", "))
+	}
+
+	if len(status.Pending) > 0 {
+		return fmt.Errorf("%w: database is at version %q, expected %q",
+			ErrSchemaOutdated, status.Current(), status.Pending[len(status.Pending)-1].Version)
+	}
+
+	return nil
+}
+
+// Status reads the migration history of the database. It creates MigrationsTable if it does not exist.
+func (m Migrator) Status(ctx context.Context) (*MigrationStatus, error) {
+	migrations, err := m.Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.ensureMigrationsTable(ctx); err != nil {
+		return nil, err
+	}
+
+	applied, err := m.appliedVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &MigrationStatus{}
+	known := make(map[string]bool, len(migrations))
+
+	for _, migration := range migrations {
+		known[migration.Version] = true
+
+		if applied[migration.Version] {
+			status.Applied = append(status.Applied, migration)
+		} else {
+			status.Pending = append(status.Pending, migration)
+		}
+	}
+
+	for version := range applied {
+		if !known[version] {
+			status.Unknown = append(status.Unknown, version)
+		}
+	}
+
+	sort.Strings(status.Unknown)
+
+	return status, nil
+}
+
+// Up applies the first n pending migrations, or all of them if n is not positive, and returns them.
+func (m Migrator) Up(ctx context.Context, n int) (_ []Migration, err error) {
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { err = errors.Join(err, unlock()) }()
+
+	if err := m.verifyChecksum(); err != nil {
+		return nil, err
+	}
+
+	status, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := status.Pending
+	if n > 0 && n < len(pending) {
+		pending = pending[:n]
+	}
+
+	for i, migration := range pending {
+		insert, args := entsql.Dialect(m.Dialect).
+			Insert(MigrationsTable).
+			Columns("version", "name", "applied_at").
+			Values(migration.Version, migration.Name, time.Now().UTC()).
+			Query()
+
+		if err := m.execute(ctx, migration.up, insert, args); err != nil {
+			return pending[:i], fmt.Errorf("could not apply migration %s: %w", migration.Version, err)
+		}
+
+		m.Logger.Info().Msgf("Applied migration %s_%s", migration.Version, migration.Name)
+	}
+
+	return pending, nil
+}
+
+// Down reverts the last n applied migrations and returns them, most recent first.
+func (m Migrator) Down(ctx context.Context, n int) (_ []Migration, err error) {
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { err = errors.Join(err, unlock()) }()
+
+	if err := m.verifyChecksum(); err != nil {
+		return nil, err
+	}
+
+	status, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(status.Unknown) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownMigration, strings.Join(status.Unknown, ", "))
+	}
+
+	var reverted []Migration
+
+	for i := len(status.Applied) - 1; i >= 0 && len(reverted) < n; i-- {
+		migration := status.Applied[i]
+
+		del, args := entsql.Dialect(m.Dialect).
+			Delete(MigrationsTable).
+			Where(entsql.EQ("version", migration.Version)).
+			Query()
+
+		if err := m.execute(ctx, migration.down, del, args); err != nil {
+			return reverted, fmt.Errorf("could not revert migration %s: %w", migration.Version, err)
+		}
+
+		m.Logger.Info().Msgf("Reverted migration %s_%s", migration.Version, migration.Name)
+
+		reverted = append(reverted, migration)
+	}
+
+	return reverted, nil
+}
+
+// Migrations lists the migrations of the directory, oldest first.
+func (m Migrator) Migrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(m.Dir, ".")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidMigrationFS, err)
+	}
+
+	byVersion := map[string]*Migration{}
+
+	for _, entry := range entries {
+		file := entry.Name()
+
+		base, isUp := strings.CutSuffix(file, ".up.sql")
+		if !isUp {
+			var isDown bool
+			if base, isDown = strings.CutSuffix(file, ".down.sql"); !isDown {
+				continue
+			}
+		}
+
+		version, name, _ := strings.Cut(base, "_")
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		}
+
+		if isUp {
+			migration.up = file
+		} else {
+			migration.down = file
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+
+	for _, migration := range byVersion {
+		if migration.up == "" || migration.down == "" {
+			return nil, fmt.Errorf("%w: migration %s must have both an up and a down file", ErrInvalidMigrationFS,
+				migration.Version)
+		}
+
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// lock takes the migration lock of the dialect, if any, on a connection of its own, which unlock gives back.
+func (m Migrator) lock(ctx context.Context) (unlock func() error, err error) {
+	d, err := lookupDriver(m.Dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.lockMigrations == nil {
+		return func() error { return nil }, nil
+	}
+
+	conn, err := m.DB.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not lock the migrations: %w", err)
+	}
+
+	release, err := d.lockMigrations(ctx, conn)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("could not lock the migrations: %w", err), conn.Close())
+	}
+
+	return func() error {
+		// the lock is released even if ctx was canceled during the migrations
+		if err := release(context.WithoutCancel(ctx)); err != nil {
+			return errors.Join(fmt.Errorf("could not unlock the migrations: %w", err), conn.Close())
+		}
+
+		return conn.Close()
+	}, nil
+}
+
+// verifyChecksum compares the migration files with the atlas.sum file written along with them, so that a migration
+// edited after it was generated is not applied.
+func (m Migrator) verifyChecksum() error {
+	data, err := fs.ReadFile(m.Dir, atlasmigrate.HashFileName)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrChecksumMismatch, err)
+	}
+
+	var expected atlasmigrate.HashFile
+	if err := expected.UnmarshalText(data); err != nil {
+		return fmt.Errorf("%w: %w", ErrChecksumMismatch, err)
+	}
+
+	names, err := fs.Glob(m.Dir, "*.sql")
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidMigrationFS, err)
+	}
+
+	sort.Strings(names)
+
+	files := make([]atlasmigrate.File, len(names))
+
+	for i, name := range names {
+		content, err := fs.ReadFile(m.Dir, name)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidMigrationFS, err)
+		}
+
+		files[i] = atlasmigrate.NewLocalFile(name, content)
+	}
+
+	actual, err := atlasmigrate.NewHashFile(files)
+	if err != nil {
+		return err
+	}
+
+	// the hash of a file covers the files before it, so the first difference is the file that changed
+	for i, file := range actual {
+		if i >= len(expected) || file != expected[i] {
+			return fmt.Errorf("%w: %s", ErrChecksumMismatch, file.N)
+		}
+	}
+
+	if len(expected) > len(actual) {
+		return fmt.Errorf("%w: %s is missing", ErrChecksumMismatch, expected[len(actual)].N)
+	}
+
+	return nil
+}
+
+func (m Migrator) ensureMigrationsTable(ctx context.Context) error {
+	_, err := m.DB.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+MigrationsTable+" ("+
+		"version VARCHAR(255) NOT NULL PRIMARY KEY, "+
+		"name VARCHAR(255) NOT NULL, "+
+		"applied_at TIMESTAMP NOT NULL)")
+	if err != nil {
+		return fmt.Errorf("could not create %s: %w", MigrationsTable, err)
+	}
+
+	return nil
+}
+
+func (m Migrator) appliedVersions(ctx context.Context) (map[string]bool, error) {
+	query, args := entsql.Dialect(m.Dialect).Select("version").From(entsql.Table(MigrationsTable)).Query()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %w", MigrationsTable, err)
+	}
+	defer rows.Close()
+
+	applied := map[string]bool{}
+
+	for rows.Next() {
+		var version string
+		if err := rows.Scan(&version); err != nil {
+			return nil, fmt.Errorf("could not read %s: %w", MigrationsTable, err)
+		}
+
+		applied[version] = true
+	}
+
+	return applied, rows.Err()
+}
+
+// execute runs the statements of a migration file and the history update in one transaction.
+func (m Migrator) execute(ctx context.Context, file, historyQuery string, historyArgs []any) error {
+	content, err := fs.ReadFile(m.Dir, file)
+	if err != nil {
 		return err
 	}
 
-	m.Logger.Info().Msgf("Migrated schema with following changes: %s", buffer.String())
+	stmts, err := atlasmigrate.Stmts(string(content))
+	if err != nil {
+		return fmt.Errorf("could not parse %s: %w", file, err)
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, stmt := range stmts {
+		if _, err := tx.ExecContext(ctx, stmt.Text); err != nil {
+			return errors.Join(fmt.Errorf("%s: %w", file, err), tx.Rollback())
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, historyQuery, historyArgs...); err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
 
-	return m.Ent.Schema.Create(ctx)
+	return tx.Commit()
 }
@@ -0,0 +1,141 @@
+package entwrap
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"entgo.io/ent/dialect"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/PopescuStefanRadu/ent-demo/pkg/entwrap"
+
+// TracingDriver records a span for every query made through the wrapped driver, and for every transaction, from its
+// start to its commit or rollback. The spans are children of the span of the context of the query, so that they
+// show up within the request that made them.
+type TracingDriver struct {
+	dialect.Driver
+	tracer   trace.Tracer
+	dbSystem attribute.KeyValue
+}
+
+// NewTracingDriver wraps drv, usually the driver returned by entsql.OpenDB. The spans go to the global tracer
+// provider, see otel.SetTracerProvider.
+func NewTracingDriver(drv dialect.Driver) *TracingDriver {
+	dbSystem := semconv.DBSystemOtherSQL
+	if d, ok := drivers[drv.Dialect()]; ok {
+		dbSystem = d.dbSystem
+	}
+
+	return &TracingDriver{Driver: drv, tracer: otel.Tracer(tracerName), dbSystem: dbSystem}
+}
+
+func (d *TracingDriver) Exec(ctx context.Context, query string, args, v any) error {
+	return d.traceQuery(ctx, "ent.Exec", query, func(ctx context.Context) error {
+		return d.Driver.Exec(ctx, query, args, v)
+	})
+}
+
+func (d *TracingDriver) Query(ctx context.Context, query string, args, v any) error {
+	return d.traceQuery(ctx, "ent.Query", query, func(ctx context.Context) error {
+		return d.Driver.Query(ctx, query, args, v)
+	})
+}
+
+func (d *TracingDriver) Tx(ctx context.Context) (dialect.Tx, error) {
+	return d.traceTx(ctx, func(ctx context.Context) (dialect.Tx, error) {
+		return d.Driver.Tx(ctx)
+	})
+}
+
+// BeginTx is supported when the wrapped driver supports it, like the one of entsql.
+func (d *TracingDriver) BeginTx(ctx context.Context, opts *sql.TxOptions) (dialect.Tx, error) {
+	drv, ok := d.Driver.(interface {
+		BeginTx(context.Context, *sql.TxOptions) (dialect.Tx, error)
+	})
+	if !ok {
+		return nil, errors.New("Driver.BeginTx is not supported")
+	}
+
+	return d.traceTx(ctx, func(ctx context.Context) (dialect.Tx, error) {
+		return drv.BeginTx(ctx, opts)
+	})
+}
+
+func (d *TracingDriver) traceQuery(ctx context.Context, name, query string, fn func(context.Context) error) error {
+	ctx, span := d.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		d.dbSystem,
+		semconv.DBStatement(query),
+	))
+	defer span.End()
+
+	err := fn(ctx)
+	recordError(span, err)
+
+	return err
+}
+
+func (d *TracingDriver) traceTx(ctx context.Context, begin func(context.Context) (dialect.Tx, error)) (dialect.Tx, error) {
+	ctx, span := d.tracer.Start(ctx, "ent.Tx", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		d.dbSystem,
+	))
+
+	tx, err := begin(ctx)
+	if err != nil {
+		recordError(span, err)
+		span.End()
+
+		return nil, err
+	}
+
+	return &tracingTx{Tx: tx, driver: d, span: span}, nil
+}
+
+// tracingTx ends the span of the transaction when it is committed or rolled back.
+type tracingTx struct {
+	dialect.Tx
+	driver *TracingDriver
+	span   trace.Span
+}
+
+func (t *tracingTx) Exec(ctx context.Context, query string, args, v any) error {
+	return t.driver.traceQuery(ctx, "ent.Exec", query, func(ctx context.Context) error {
+		return t.Tx.Exec(ctx, query, args, v)
+	})
+}
+
+func (t *tracingTx) Query(ctx context.Context, query string, args, v any) error {
+	return t.driver.traceQuery(ctx, "ent.Query", query, func(ctx context.Context) error {
+		return t.Tx.Query(ctx, query, args, v)
+	})
+}
+
+func (t *tracingTx) Commit() error {
+	return t.end("commit", t.Tx.Commit())
+}
+
+func (t *tracingTx) Rollback() error {
+	return t.end("rollback", t.Tx.Rollback())
+}
+
+func (t *tracingTx) end(outcome string, err error) error {
+	t.span.SetAttributes(attribute.String("db.transaction.outcome", outcome))
+	recordError(t.span, err)
+	t.span.End()
+
+	return err
+}
+
+func recordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
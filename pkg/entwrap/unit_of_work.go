@@ -0,0 +1,43 @@
+package entwrap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/PopescuStefanRadu/ent-demo/pkg/ent"
+	businessUser "github.com/PopescuStefanRadu/ent-demo/pkg/user"
+)
+
+type UnitOfWork struct {
+	Client *ent.Client
+}
+
+func (uow *UnitOfWork) WithinTx(ctx context.Context, fn func(repo businessUser.Repository) error) error {
+	tx, err := uow.Client.Tx(ctx)
+	if err != nil {
+		return fmt.Errorf("could not start transaction: %w", translateError(err))
+	}
+
+	defer func() {
+		if v := recover(); v != nil {
+			_ = tx.Rollback()
+
+			panic(v)
+		}
+	}()
+
+	if err := fn(&UserRepository{Client: tx.User}); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return errors.Join(err, fmt.Errorf("could not roll back transaction: %w", rollbackErr))
+		}
+
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit transaction: %w", translateError(err))
+	}
+
+	return nil
+}
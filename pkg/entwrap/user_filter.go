@@ -0,0 +1,132 @@
+package entwrap
+
+import (
+	"fmt"
+
+	entsql "entgo.io/ent/dialect/sql"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/ent/predicate"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/ent/user"
+	businessUser "github.com/PopescuStefanRadu/ent-demo/pkg/user"
+)
+
+//nolint:gochecknoglobals
+var (
+	sortColumns = map[businessUser.SortField]string{
+		businessUser.SortByID:        user.FieldID,
+		businessUser.SortByUsername:  user.FieldUsername,
+		businessUser.SortByEmail:     user.FieldEmail,
+		businessUser.SortByCreatedAt: user.FieldCreatedAt,
+		businessUser.SortByUpdatedAt: user.FieldUpdatedAt,
+	}
+	sortOrders = map[businessUser.SortField]func(...entsql.OrderTermOption) user.OrderOption{
+		businessUser.SortByID:        user.ByID,
+		businessUser.SortByUsername:  user.ByUsername,
+		businessUser.SortByEmail:     user.ByEmail,
+		businessUser.SortByCreatedAt: user.ByCreatedAt,
+		businessUser.SortByUpdatedAt: user.ByUpdatedAt,
+	}
+)
+
+// sortKeys validates the requested sort and appends ID as the last key, unless already present, so that the order is
+// total and can be used for keyset pagination.
+func sortKeys(sort []businessUser.SortKey) ([]businessUser.SortKey, error) {
+	keys := make([]businessUser.SortKey, 0, len(sort)+1)
+	hasID := false
+
+	for _, key := range sort {
+		if _, ok := sortColumns[key.Field]; !ok {
+			return nil, fmt.Errorf("%w: unknown sort field %q", businessUser.ErrInvalidInput, key.Field)
+		}
+
+		hasID = hasID || key.Field == businessUser.SortByID
+		keys = append(keys, key)
+	}
+
+	if !hasID {
+		keys = append(keys, businessUser.SortKey{Field: businessUser.SortByID})
+	}
+
+	return keys, nil
+}
+
+func orderOptions(sort []businessUser.SortKey) []user.OrderOption {
+	opts := make([]user.OrderOption, len(sort))
+
+	for i, key := range sort {
+		if key.Desc {
+			opts[i] = sortOrders[key.Field](entsql.OrderDesc())
+		} else {
+			opts[i] = sortOrders[key.Field]()
+		}
+	}
+
+	return opts
+}
+
+// filterPredicates builds the predicates of the filter. Times are compared in UTC, the zone they are stored in:
+// SQLite stores them as text, so a bound with another offset would be compared character by character.
+func filterPredicates(filter *businessUser.FindAllFilter) []predicate.User {
+	if filter == nil {
+		return nil
+	}
+
+	var preds []predicate.User
+
+	if len(filter.IdsIn) > 0 {
+		preds = append(preds, user.IDIn(filter.IdsIn...))
+	}
+
+	if filter.Username != "" {
+		preds = append(preds, user.UsernameEQ(filter.Username))
+	}
+
+	if filter.UsernamePrefix != "" {
+		preds = append(preds, user.UsernameHasPrefix(filter.UsernamePrefix))
+	}
+
+	if filter.EmailDomain != "" {
+		preds = append(preds, user.EmailHasSuffix("@"+filter.EmailDomain))
+	}
+
+	if from := filter.CreatedAt.From; from != nil {
+		preds = append(preds, user.CreatedAtGTE(from.UTC()))
+	}
+
+	if to := filter.CreatedAt.To; to != nil {
+		preds = append(preds, user.CreatedAtLT(to.UTC()))
+	}
+
+	if from := filter.UpdatedAt.From; from != nil {
+		preds = append(preds, user.UpdatedAtGTE(from.UTC()))
+	}
+
+	if to := filter.UpdatedAt.To; to != nil {
+		preds = append(preds, user.UpdatedAtLT(to.UTC()))
+	}
+
+	return preds
+}
+
+// afterPredicate matches the users that come after the cursor in the given sort:
+// (k1 > v1) OR (k1 = v1 AND k2 > v2) OR ..., with < instead of > for descending keys.
+func afterPredicate(sort []businessUser.SortKey, c cursor) predicate.User {
+	alternatives := make([]predicate.User, len(sort))
+
+	for i, key := range sort {
+		terms := make([]predicate.User, 0, i+1)
+
+		for _, prev := range sort[:i] {
+			terms = append(terms, entsql.FieldEQ(sortColumns[prev.Field], c.value(prev.Field)))
+		}
+
+		if key.Desc {
+			terms = append(terms, entsql.FieldLT(sortColumns[key.Field], c.value(key.Field)))
+		} else {
+			terms = append(terms, entsql.FieldGT(sortColumns[key.Field], c.value(key.Field)))
+		}
+
+		alternatives[i] = user.And(terms...)
+	}
+
+	return user.Or(alternatives...)
+}
@@ -2,8 +2,10 @@ package entwrap
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/PopescuStefanRadu/ent-demo/pkg/ent"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/ent/schema"
 	"github.com/PopescuStefanRadu/ent-demo/pkg/ent/user"
 	businessUser "github.com/PopescuStefanRadu/ent-demo/pkg/user"
 )
@@ -14,61 +16,164 @@ type UserRepository struct {
 
 func (ur *UserRepository) GetByID(ctx context.Context, id int) (*businessUser.User, error) {
 	u, err := ur.Client.Get(ctx, id)
-	return toPtrBusinessModel(u), err
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	return toPtrBusinessModel(u), nil
 }
 
 func (ur *UserRepository) Create(ctx context.Context, u *businessUser.CreateUserParams) (*businessUser.User, error) {
 	createdUser, err := ur.Client.Create().
 		SetUsername(u.Username).
 		SetEmail(u.Email).
+		SetDogPhotoURL(u.DogPhotoURL).
 		Save(ctx)
 	if err != nil {
-		return nil, err
+		return nil, translateError(err)
 	}
 
-	return toPtrBusinessModel(createdUser), err
+	return toPtrBusinessModel(createdUser), nil
 }
 
+// CreateBulk inserts all the users in a single statement, which the database applies atomically.
+func (ur *UserRepository) CreateBulk(
+	ctx context.Context,
+	params []businessUser.CreateUserParams,
+) ([]businessUser.User, error) {
+	createdUsers, err := ur.Client.MapCreateBulk(params, func(create *ent.UserCreate, i int) {
+		create.SetUsername(params[i].Username).SetEmail(params[i].Email).SetDogPhotoURL(params[i].DogPhotoURL)
+	}).Save(ctx)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	return toBusinessModelSlice(createdUsers), nil
+}
+
+// FindAllByFilter returns the users matching the filter in the requested sort. It fetches one row more than the page
+// limit to find out whether a next page exists, in which case the cursor holds the sort values of the last user.
 func (ur *UserRepository) FindAllByFilter(
 	ctx context.Context,
 	filter *businessUser.FindAllFilter,
-) ([]businessUser.User, error) {
-	if filter == nil || len(filter.IdsIn) == 0 {
-		users, err := ur.Client.Query().Where().All(ctx)
+) (*businessUser.Page, error) {
+	var sort []businessUser.SortKey
+	if filter != nil {
+		sort = filter.Sort
+	}
+
+	sort, err := sortKeys(sort)
+	if err != nil {
+		return nil, err
+	}
+
+	query := ur.Client.Query().Where(filterPredicates(filter)...).Order(orderOptions(sort)...)
+
+	if filter != nil && filter.After != "" {
+		after, err := decodeCursor(filter.After, sort)
 		if err != nil {
 			return nil, err
 		}
 
-		return toBusinessModelSlice(users), nil
+		query.Where(afterPredicate(sort, after))
 	}
 
-	filteredUsers, err := ur.Client.Query().Where(user.IDIn(filter.IdsIn...)).All(ctx)
+	limit := filter.PageLimit()
+
+	users, err := query.Limit(limit + 1).All(ctx)
 	if err != nil {
-		return nil, err
+		return nil, translateError(err)
+	}
+
+	page := &businessUser.Page{Limit: limit}
+
+	if len(users) > limit {
+		users = users[:limit]
+
+		page.NextCursor, err = encodeCursor(newCursor(sort, users[limit-1]))
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return toBusinessModelSlice(filteredUsers), nil
+	page.Users = toBusinessModelSlice(users)
+
+	return page, nil
 }
 
+// Update applies the change only if the stored version still matches u.Version, in the same statement that increments
+// it, so that concurrent updates based on the same version cannot both succeed.
 func (ur *UserRepository) Update(ctx context.Context, u *businessUser.UpdateUserParams) (*businessUser.User, error) {
-	err := ur.Client.Update().
-		Where(user.ID(u.ID)).
-		SetUsername(u.Username).
-		SetEmail(u.Email).
-		Exec(ctx)
+	update := ur.Client.UpdateOneID(u.ID).
+		SetNillableUsername(u.Username).
+		SetNillableEmail(u.Email).
+		SetNillableDogPhotoURL(u.DogPhotoURL).
+		AddVersion(1)
+
+	if u.Version != 0 {
+		update.Where(user.Version(u.Version))
+	}
+
+	updated, err := update.Save(ctx)
+	if ent.IsNotFound(err) && u.Version != 0 {
+		return nil, ur.versionMismatchOrNotFound(ctx, u.ID, err)
+	}
+
 	if err != nil {
-		return nil, err
+		return nil, translateError(err)
+	}
+
+	return toPtrBusinessModel(updated), nil
+}
+
+// versionMismatchOrNotFound tells apart the reasons for which a versioned update did not match any row.
+func (ur *UserRepository) versionMismatchOrNotFound(ctx context.Context, id int, notFound error) error {
+	exists, err := ur.Client.Query().Where(user.ID(id)).Exist(ctx)
+	if err != nil {
+		return translateError(err)
+	}
+
+	if !exists {
+		return translateError(notFound)
 	}
 
-	return ur.GetByID(ctx, u.ID)
+	return fmt.Errorf("%w: user %d", businessUser.ErrVersionMismatch, id)
 }
 
+// DeleteByID soft deletes the user, see schema.SoftDeleteMixin.
 func (ur *UserRepository) DeleteByID(ctx context.Context, id int) error {
-	return ur.Client.DeleteOneID(id).Exec(ctx)
+	return translateError(ur.Client.DeleteOneID(id).Exec(ctx))
+}
+
+// RestoreByID undoes the soft delete of a user. Restoring a user that is not deleted has no effect, its version is
+// left as is.
+func (ur *UserRepository) RestoreByID(ctx context.Context, id int) (*businessUser.User, error) {
+	restored, err := ur.Client.UpdateOneID(id).
+		Where(user.DeletedAtNotNil()).
+		ClearDeletedAt().
+		AddVersion(1).
+		Save(schema.SkipSoftDelete(ctx))
+	if ent.IsNotFound(err) {
+		existing, err := ur.Client.Get(ctx, id)
+		return toPtrBusinessModel(existing), translateError(err)
+	}
+
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	return toPtrBusinessModel(restored), nil
+}
+
+// PurgeByID permanently deletes the user, whether soft deleted or not.
+func (ur *UserRepository) PurgeByID(ctx context.Context, id int) error {
+	return translateError(ur.Client.DeleteOneID(id).Exec(schema.SkipSoftDelete(ctx)))
 }
 
+// DeleteAll permanently deletes all users, including the soft deleted ones.
 func (ur *UserRepository) DeleteAll(ctx context.Context) (int, error) {
-	return ur.Client.Delete().Exec(ctx)
+	deleted, err := ur.Client.Delete().Exec(schema.SkipSoftDelete(ctx))
+	return deleted, translateError(err)
 }
 
 func toBusinessModelSlice(users []*ent.User) []businessUser.User {
@@ -97,10 +202,12 @@ func toPtrBusinessModel(u *ent.User) *businessUser.User {
 
 func toBusinessModel(u *ent.User) businessUser.User {
 	return businessUser.User{
-		ID:        u.ID,
-		Username:  u.Username,
-		Email:     u.Email,
-		CreatedAt: u.CreatedAt,
-		UpdatedAt: u.UpdatedAt,
+		ID:          u.ID,
+		Username:    u.Username,
+		Email:       u.Email,
+		DogPhotoURL: u.DogPhotoURL,
+		CreatedAt:   u.CreatedAt,
+		UpdatedAt:   u.UpdatedAt,
+		Version:     u.Version,
 	}
 }
@@ -0,0 +1,165 @@
+package dog
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/PopescuStefanRadu/ent-demo/pkg/user"
+	"github.com/rs/zerolog"
+)
+
+// CacheConfig configures the pool of URLs kept by CachingClient to answer when the upstream fails or is slow. The cache
+// is disabled when Size is not positive.
+type CacheConfig struct {
+	// Size is the maximum number of URLs in the pool. The least recently used URL is evicted first.
+	Size int
+	// TTL is how long a fetched URL can be served from the pool. Zero keeps URLs until they are evicted.
+	TTL time.Duration
+	// ServeAfter is how long to wait for the upstream before serving a URL from the pool instead. Zero always waits
+	// for the upstream to answer.
+	ServeAfter time.Duration
+}
+
+// CachingClient decorates a user.Dog with a pool of the URLs it recently fetched, as a fallback: it does not reduce the
+// calls to the upstream, since every call still asks it for a new URL, but answers from the pool when the upstream
+// fails, e.g. because its circuit breaker is open, or is slower than CacheConfig.ServeAfter. Serving from the pool
+// first would give the same photo to many users, and to the prefetch pool, which is the way to avoid waiting for the
+// upstream. URLs are served from the pool in least recently used order, so that the same URL is repeated as rarely as
+// possible.
+type CachingClient struct {
+	Upstream user.Dog
+	Config   CacheConfig
+
+	mu      sync.Mutex
+	entries *list.List // of *cacheEntry, most recently used first
+	byURL   map[string]*list.Element
+	now     func() time.Time
+}
+
+type cacheEntry struct {
+	url       string
+	fetchedAt time.Time
+}
+
+func NewCachingClient(upstream user.Dog, config CacheConfig) *CachingClient {
+	return &CachingClient{
+		Upstream: upstream,
+		Config:   config,
+		entries:  list.New(),
+		byURL:    map[string]*list.Element{},
+		now:      time.Now,
+	}
+}
+
+type fetchResult struct {
+	url string
+	err error
+}
+
+func (c *CachingClient) GetRandomDogURL(ctx context.Context) (string, error) {
+	resCh := make(chan fetchResult, 1)
+
+	go func() {
+		url, err := c.Upstream.GetRandomDogURL(ctx)
+		if err == nil {
+			c.add(url)
+		}
+
+		resCh <- fetchResult{url: url, err: err}
+	}()
+
+	var serveAfter <-chan time.Time
+
+	if c.Config.ServeAfter > 0 {
+		timer := time.NewTimer(c.Config.ServeAfter)
+		defer timer.Stop()
+
+		serveAfter = timer.C
+	}
+
+	select {
+	case res := <-resCh:
+		return c.fallback(ctx, res)
+	case <-serveAfter:
+		if url, ok := c.take(); ok {
+			zerolog.Ctx(ctx).Debug().Msg("GetRandomDogURL: upstream is slow, serving a cached URL")
+			return url, nil
+		}
+
+		return c.fallback(ctx, <-resCh)
+	}
+}
+
+// fallback serves a URL from the pool if the upstream failed for reasons other than the cancellation of the request.
+func (c *CachingClient) fallback(ctx context.Context, res fetchResult) (string, error) {
+	if res.err == nil || errors.Is(res.err, context.Canceled) || ctx.Err() != nil {
+		return res.url, res.err
+	}
+
+	url, ok := c.take()
+	if !ok {
+		return "", res.err
+	}
+
+	zerolog.Ctx(ctx).Warn().Err(res.err).Msg("GetRandomDogURL: upstream failed, serving a cached URL")
+
+	return url, nil
+}
+
+// add puts a URL at the front of the pool, evicting the least recently used URLs beyond the size of the pool.
+func (c *CachingClient) add(url string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &cacheEntry{url: url, fetchedAt: c.now()}
+
+	if elem, ok := c.byURL[url]; ok {
+		elem.Value = entry
+		c.entries.MoveToFront(elem)
+
+		return
+	}
+
+	c.byURL[url] = c.entries.PushFront(entry)
+
+	for c.entries.Len() > c.Config.Size {
+		c.remove(c.entries.Back())
+	}
+}
+
+// take returns the least recently used URL that has not expired and moves it to the front of the pool.
+func (c *CachingClient) take() (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for elem := c.entries.Back(); elem != nil; elem = c.entries.Back() {
+		entry := elem.Value.(*cacheEntry) //nolint:forcetypeassert
+
+		if c.Config.TTL > 0 && c.now().Sub(entry.fetchedAt) >= c.Config.TTL {
+			c.remove(elem)
+			continue
+		}
+
+		c.entries.MoveToFront(elem)
+
+		return entry.url, true
+	}
+
+	return "", false
+}
+
+func (c *CachingClient) remove(elem *list.Element) {
+	delete(c.byURL, elem.Value.(*cacheEntry).url) //nolint:forcetypeassert
+	c.entries.Remove(elem)
+}
+
+// Len returns the number of URLs in the pool, including the expired ones that were not yet dropped.
+func (c *CachingClient) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.entries.Len()
+}
@@ -0,0 +1,110 @@
+package dog_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/PopescuStefanRadu/ent-demo/pkg/external/dog"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/user"
+	mockUser "github.com/PopescuStefanRadu/ent-demo/pkg/user/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestCachingClientServesFromPoolWhenUpstreamFails(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	upstream := mockUser.NewMockDog(gomock.NewController(t))
+
+	gomock.InOrder(
+		upstream.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org/1.jpg", nil),
+		upstream.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org/2.jpg", nil),
+		upstream.EXPECT().GetRandomDogURL(gomock.Any()).Return("", user.ErrDependencyUnavailable).Times(3),
+	)
+
+	client := dog.NewCachingClient(upstream, dog.CacheConfig{Size: 2})
+
+	for _, expected := range []string{"https://example.org/1.jpg", "https://example.org/2.jpg"} {
+		url, err := client.GetRandomDogURL(ctx)
+		r.NoError(err)
+		r.Equal(expected, url)
+	}
+
+	// least recently used first
+	for _, expected := range []string{"https://example.org/1.jpg", "https://example.org/2.jpg", "https://example.org/1.jpg"} {
+		url, err := client.GetRandomDogURL(ctx)
+		r.NoError(err)
+		r.Equal(expected, url)
+	}
+}
+
+func TestCachingClientEvictsAndExpires(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	upstream := mockUser.NewMockDog(gomock.NewController(t))
+
+	gomock.InOrder(
+		upstream.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org/1.jpg", nil),
+		upstream.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org/2.jpg", nil),
+		upstream.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org/3.jpg", nil),
+		upstream.EXPECT().GetRandomDogURL(gomock.Any()).Return("", user.ErrDependencyFailure),
+		upstream.EXPECT().GetRandomDogURL(gomock.Any()).Return("", user.ErrDependencyFailure),
+	)
+
+	client := dog.NewCachingClient(upstream, dog.CacheConfig{Size: 2, TTL: 100 * time.Millisecond})
+
+	for i := 0; i < 3; i++ {
+		_, err := client.GetRandomDogURL(ctx)
+		r.NoError(err)
+	}
+
+	r.Equal(2, client.Len())
+
+	url, err := client.GetRandomDogURL(ctx)
+	r.NoError(err)
+	r.Equal("https://example.org/2.jpg", url)
+
+	time.Sleep(100 * time.Millisecond)
+
+	_, err = client.GetRandomDogURL(ctx)
+	r.ErrorIs(err, user.ErrDependencyFailure)
+	r.Equal(0, client.Len())
+}
+
+func TestCachingClientServesFromPoolWhenUpstreamIsSlow(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	upstream := mockUser.NewMockDog(gomock.NewController(t))
+	release := make(chan struct{})
+
+	gomock.InOrder(
+		upstream.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org/1.jpg", nil),
+		upstream.EXPECT().GetRandomDogURL(gomock.Any()).DoAndReturn(func(context.Context) (string, error) {
+			<-release
+			return "https://example.org/2.jpg", nil
+		}).Times(2),
+	)
+
+	client := dog.NewCachingClient(upstream, dog.CacheConfig{Size: 2, ServeAfter: 10 * time.Millisecond})
+
+	url, err := client.GetRandomDogURL(ctx)
+	r.NoError(err)
+	r.Equal("https://example.org/1.jpg", url)
+
+	url, err = client.GetRandomDogURL(ctx)
+	r.NoError(err)
+	r.Equal("https://example.org/1.jpg", url)
+
+	// an empty pool waits for the upstream
+	client = dog.NewCachingClient(upstream, dog.CacheConfig{Size: 2, ServeAfter: 10 * time.Millisecond})
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+	}()
+
+	url, err = client.GetRandomDogURL(ctx)
+	r.NoError(err)
+	r.Equal("https://example.org/2.jpg", url)
+}
@@ -6,25 +6,113 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
+	"time"
 
+	"github.com/PopescuStefanRadu/ent-demo/pkg/requestid"
 	"github.com/PopescuStefanRadu/ent-demo/pkg/user"
+	"github.com/cenkalti/backoff/v4"
 	"github.com/goccy/go-json"
 	"github.com/rs/zerolog"
 	"github.com/sony/gobreaker"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
-var ErrCouldNotReadResponse = errors.New("GetRandomDogURL: could not read response")
+const tracerName = "github.com/PopescuStefanRadu/ent-demo/pkg/external/dog"
+
+var (
+	ErrCouldNotReadResponse = errors.New("GetRandomDogURL: could not read response")
+	ErrUnexpectedStatus     = errors.New("GetRandomDogURL: unexpected status")
+	ErrMalformedResponse    = errors.New("GetRandomDogURL: malformed response")
+)
+
+const (
+	// maxSnippet is the length of the response bodies quoted in the errors, which can end up in logs and responses.
+	maxSnippet = 64
+	// maxDrain is the length of the rest of a response body read before closing it, so that the connection can be
+	// reused. Longer bodies are not worth reading and close the connection.
+	maxDrain = 512 << 10
+)
+
+// API is the flavour of API that Client talks to.
+type API string
+
+const (
+	// APIRandomDog answers GET /woof.json with {"url": "..."}, like https://random.dog.
+	APIRandomDog API = "random.dog"
+	// APIDogCEO answers GET /api/breeds/image/random with {"message": "...", "status": "success"}, like
+	// https://dog.ceo.
+	APIDogCEO API = "dog.ceo"
+)
+
+//nolint:gochecknoglobals
+var defaultPaths = map[API]string{
+	APIRandomDog: "/woof.json",
+	APIDogCEO:    "/api/breeds/image/random",
+}
+
+// imageHosts are the hosts that the public instances of the APIs serve their images from.
+//
+//nolint:gochecknoglobals
+var imageHosts = map[API]string{
+	APIRandomDog: "random.dog",
+	APIDogCEO:    "images.dog.ceo",
+}
+
+// ImageHosts lists the hosts of the images of all the APIs, sorted, to be allowed by ValidationConfig.AllowedHosts.
+func ImageHosts() []string {
+	hosts := make([]string, 0, len(imageHosts))
+	for _, host := range imageHosts {
+		hosts = append(hosts, host)
+	}
+
+	sort.Strings(hosts)
+
+	return hosts
+}
 
 type ClientConfig struct {
-	Enabled                bool
-	BaseURL                string
+	Enabled bool
+	// API defaults to APIRandomDog.
+	API     API
+	BaseURL string
+	// Path overrides the default path of the API, e.g. to fetch the images of a single breed.
+	Path string
+	// CircuitBreakerSettings configure the circuit breaker of the client. Name defaults to the API, and labels the
+	// state of the breaker in the metrics, which are fed from OnStateChange in addition to the callback set here.
 	CircuitBreakerSettings gobreaker.Settings
+	Retry                  RetryConfig
+	Validation             ValidationConfig
+	Cache                  CacheConfig
+}
+
+// RetryConfig configures how Client retries the requests that fail with a network error or a 5xx status. The zero
+// value makes a single attempt, without timeout.
+type RetryConfig struct {
+	// MaxRetries is the number of attempts after the first one.
+	MaxRetries uint64
+	// AttemptTimeout bounds each attempt. Zero means no timeout.
+	AttemptTimeout time.Duration
+	// Deadline bounds all the attempts together, including the waits between them. The deadline of the request
+	// context is respected either way. Zero means no deadline.
+	Deadline time.Duration
+	// InitialInterval is the wait before the first retry. It grows exponentially, with jitter, for the next ones.
+	InitialInterval time.Duration
+	// MaxInterval caps the wait between two attempts.
+	MaxInterval time.Duration
 }
 
 type Client struct {
 	ClientConfig
 	CircuitBreaker *gobreaker.CircuitBreaker
 	HTTPClient     *http.Client
+	decode         func(body []byte) (string, error)
+	tracer         trace.Tracer
 }
 
 type NoOpClient struct{}
@@ -35,49 +123,263 @@ func NewClient(config ClientConfig) user.Dog {
 		return NoOpClient{}
 	}
 
-	return &Client{
+	if config.API == "" {
+		config.API = APIRandomDog
+	}
+
+	if config.Path == "" {
+		config.Path = defaultPaths[config.API]
+	}
+
+	config.Validation = config.Validation.withDefaults()
+
+	settings := config.CircuitBreakerSettings
+	if settings.IsSuccessful == nil {
+		settings.IsSuccessful = isSuccessful
+	}
+
+	if settings.Name == "" {
+		settings.Name = string(config.API)
+	}
+
+	settings = observeStateChanges(settings)
+
+	client := &Client{
 		ClientConfig:   config,
-		CircuitBreaker: gobreaker.NewCircuitBreaker(config.CircuitBreakerSettings),
-		HTTPClient:     &http.Client{},
+		CircuitBreaker: gobreaker.NewCircuitBreaker(settings),
+		HTTPClient:     &http.Client{Transport: requestid.Transport{}},
+		tracer:         otel.Tracer(tracerName),
+		decode:         decodeRandomDog,
+	}
+
+	if config.API == APIDogCEO {
+		client.decode = decodeDogCEO
 	}
+
+	if config.Cache.Size <= 0 {
+		return client
+	}
+
+	return NewCachingClient(client, config.Cache)
 }
 
+// GetRandomDogURL fetches a URL, retrying as configured in RetryConfig, and draws again while the URL has an extension
+// that is not allowed by ValidationConfig. The retries and draws happen within a single call of the circuit breaker,
+// so that a request counts once towards tripping it, whatever the number of attempts.
 func (c *Client) GetRandomDogURL(ctx context.Context) (string, error) {
+	ctx, span := c.tracer.Start(ctx, "dog.GetRandomDogURL", trace.WithAttributes(
+		attribute.String("dog.api", string(c.API)),
+		attribute.String("dog.circuit_breaker.state", c.CircuitBreaker.State().String()),
+	))
+	defer span.End()
+
+	if c.Retry.Deadline > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, c.Retry.Deadline)
+		defer cancel()
+	}
+
+	r, err := c.CircuitBreaker.Execute(func() (interface{}, error) {
+		return c.draw(ctx)
+	})
+	if err != nil {
+		err = translateExecuteError(err)
+		recordError(span, err)
+		observeOutcome(c.API, err)
+
+		return "", err
+	}
+
+	observeOutcome(c.API, nil)
+
+	return r.(string), nil //nolint:forcetypeassert
+}
+
+func (c *Client) draw(ctx context.Context) (string, error) {
+	for draw := 0; ; draw++ {
+		url, err := backoff.RetryNotifyWithData(func() (string, error) {
+			return c.attempt(ctx)
+		}, c.backOff(ctx), func(err error, wait time.Duration) {
+			zerolog.Ctx(ctx).Debug().Err(err).Msgf("GetRandomDogURL: retrying in %s", wait)
+		})
+		if err != nil {
+			return "", err
+		}
+
+		if c.Validation.allowedMedia(url) {
+			return url, nil
+		}
+
+		if draw >= c.Validation.MaxRedraws {
+			return "", fmt.Errorf("%w: %s", ErrDisallowedMedia, url)
+		}
+
+		zerolog.Ctx(ctx).Debug().Msgf("GetRandomDogURL: drawing again, %s has a disallowed extension", url)
+	}
+}
+
+func (c *Client) backOff(ctx context.Context) backoff.BackOff { //nolint:ireturn
+	exp := backoff.NewExponentialBackOff()
+	exp.MaxElapsedTime = c.Retry.Deadline
+
+	if c.Retry.InitialInterval > 0 {
+		exp.InitialInterval = c.Retry.InitialInterval
+	}
+
+	if c.Retry.MaxInterval > 0 {
+		exp.MaxInterval = c.Retry.MaxInterval
+	}
+
+	return backoff.WithContext(backoff.WithMaxRetries(exp, c.Retry.MaxRetries), ctx)
+}
+
+// attempt makes one request. The errors that retrying cannot fix are marked as permanent.
+func (c *Client) attempt(ctx context.Context) (string, error) {
 	l := zerolog.Ctx(ctx)
 
-	path := fmt.Sprintf(c.BaseURL + "/woof.json")
+	if c.Retry.AttemptTimeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, c.Retry.AttemptTimeout)
+		defer cancel()
+	}
+
+	path := c.BaseURL + c.Path
 	l.Debug().Msgf("GetRandomDogURL: path: %s", path)
 
+	ctx, span := c.tracer.Start(ctx, "GET "+c.Path, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		semconv.HTTPRequestMethodGet,
+		semconv.URLFull(path),
+	))
+	defer span.End()
+
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, path, nil)
 	if err != nil {
-		return "", fmt.Errorf("GetRandomDogURL: could not create request: %w", err)
+		err = backoff.Permanent(fmt.Errorf("GetRandomDogURL: could not create request: %w", err))
+		recordError(span, err)
+
+		return "", err
 	}
 
-	r, err := c.CircuitBreaker.Execute(func() (interface{}, error) {
-		return c.HTTPClient.Do(req) //nolint:bodyclose
-	})
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := c.HTTPClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("GetRandomDogURL: could not execute GET: %w", err)
+		err = fmt.Errorf("GetRandomDogURL: could not execute GET: %w", err)
+		recordError(span, err)
+
+		return "", err
 	}
+	defer drainAndClose(resp.Body)
 
-	resp := r.(*http.Response) //nolint:forcetypeassert
-	defer resp.Body.Close()
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
 
-	bytes, err := io.ReadAll(resp.Body)
+	url, err := c.readURL(resp)
 	if err != nil {
-		return "", ErrCouldNotReadResponse
+		recordError(span, err)
+		return "", err
 	}
 
-	url := struct {
+	return url, nil
+}
+
+// readURL checks the response of the dog API and extracts the URL from it.
+func (c *Client) readURL(resp *http.Response) (string, error) {
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxSnippet+1))
+
+		err := &StatusError{StatusCode: resp.StatusCode, Body: snippet(body)}
+		if resp.StatusCode < http.StatusInternalServerError {
+			return "", backoff.Permanent(err)
+		}
+
+		return "", err
+	}
+
+	bytes, err := io.ReadAll(io.LimitReader(resp.Body, c.Validation.MaxBodySize+1))
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrCouldNotReadResponse, err)
+	}
+
+	if int64(len(bytes)) > c.Validation.MaxBodySize {
+		return "", backoff.Permanent(fmt.Errorf("%w: more than %d bytes", ErrResponseTooLarge, c.Validation.MaxBodySize))
+	}
+
+	url, err := c.decode(bytes)
+	if err != nil {
+		return "", backoff.Permanent(fmt.Errorf("%w: body %q: %w", ErrMalformedResponse, snippet(bytes), err))
+	}
+
+	if err := c.Validation.validateURL(url); err != nil {
+		return "", backoff.Permanent(err)
+	}
+
+	return url, nil
+}
+
+// snippet truncates a response body to be quoted in an error.
+func snippet(body []byte) string {
+	if len(body) > maxSnippet {
+		return string(body[:maxSnippet]) + "..."
+	}
+
+	return string(body)
+}
+
+func drainAndClose(body io.ReadCloser) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(body, maxDrain))
+	_ = body.Close()
+}
+
+func decodeRandomDog(body []byte) (string, error) {
+	res := struct {
 		URL string `json:"url"`
 	}{}
-	if err := json.Unmarshal(bytes, &url); err != nil {
-		return "", fmt.Errorf("GetRandomDogURL: body: %s could not decode response: %w", string(bytes), err)
+	if err := json.Unmarshal(body, &res); err != nil {
+		return "", err
+	}
+
+	return res.URL, nil
+}
+
+func decodeDogCEO(body []byte) (string, error) {
+	res := struct {
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	}{}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return "", err
 	}
 
-	return url.URL, nil
+	if res.Status != "success" {
+		return "", fmt.Errorf("status %q", res.Status)
+	}
+
+	return res.Message, nil
 }
 
 func (c NoOpClient) GetRandomDogURL(context.Context) (string, error) {
 	return "", nil
 }
+
+func recordError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// isSuccessful does not count as failures of the dog API the requests canceled by the caller, nor the ones that only
+// drew disallowed media.
+func isSuccessful(err error) bool {
+	return err == nil || errors.Is(err, context.Canceled) || errors.Is(err, ErrDisallowedMedia)
+}
+
+// translateExecuteError classifies errors of the circuit breaker call: a rejected call means that the dog API is
+// known to be unavailable, while any other failure comes from the API itself.
+func translateExecuteError(err error) error {
+	if errors.Is(err, gobreaker.ErrOpenState) || errors.Is(err, gobreaker.ErrTooManyRequests) {
+		return fmt.Errorf("GetRandomDogURL: %w: %w", user.ErrDependencyUnavailable, err)
+	}
+
+	return fmt.Errorf("GetRandomDogURL: %w: %w", user.ErrDependencyFailure, err)
+}
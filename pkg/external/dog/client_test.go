@@ -0,0 +1,358 @@
+package dog_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/PopescuStefanRadu/ent-demo/pkg/external/dog"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/requestid"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/user"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sony/gobreaker"
+	"github.com/stretchr/testify/require"
+)
+
+// newServer answers with the given statuses in order, and with the last one once they are exhausted. A zero status
+// hangs until the request is canceled.
+func newServer(t *testing.T, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	calls := &atomic.Int32{}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := int(calls.Add(1))
+		status := statuses[min(call, len(statuses))-1]
+
+		if status == 0 {
+			<-r.Context().Done()
+			return
+		}
+
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"url": "https://example.org/dog.jpg"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, calls
+}
+
+func newClient(baseURL string, retry dog.RetryConfig, settings gobreaker.Settings) user.Dog { //nolint:ireturn
+	return dog.NewClient(dog.ClientConfig{
+		Enabled:                true,
+		BaseURL:                baseURL,
+		CircuitBreakerSettings: settings,
+		Retry:                  retry,
+	})
+}
+
+func TestClientRetries(t *testing.T) {
+	retry := dog.RetryConfig{
+		MaxRetries:      2,
+		AttemptTimeout:  50 * time.Millisecond,
+		InitialInterval: time.Millisecond,
+	}
+
+	tests := []struct {
+		name          string
+		statuses      []int
+		expectedCalls int32
+		expectedErr   error
+	}{
+		{name: "success", statuses: []int{http.StatusOK}, expectedCalls: 1},
+		{name: "server errors", statuses: []int{http.StatusBadGateway, http.StatusInternalServerError, http.StatusOK},
+			expectedCalls: 3},
+		{name: "timeout", statuses: []int{0, http.StatusOK}, expectedCalls: 2},
+		{name: "too many server errors", statuses: []int{http.StatusServiceUnavailable}, expectedCalls: 3,
+			expectedErr: dog.ErrUnexpectedStatus},
+		{name: "client error", statuses: []int{http.StatusNotFound}, expectedCalls: 1,
+			expectedErr: dog.ErrUnexpectedStatus},
+	}
+
+	for _, tt := range tests {
+		ttCpy := tt
+		t.Run(tt.name, func(t *testing.T) {
+			r := require.New(t)
+			srv, calls := newServer(t, ttCpy.statuses...)
+
+			url, err := newClient(srv.URL, retry, gobreaker.Settings{}).GetRandomDogURL(context.Background())
+			if ttCpy.expectedErr != nil {
+				var statusErr *dog.StatusError
+				r.ErrorAs(err, &statusErr)
+				r.Equal(ttCpy.statuses[len(ttCpy.statuses)-1], statusErr.StatusCode)
+				r.ErrorIs(err, ttCpy.expectedErr)
+				r.ErrorIs(err, user.ErrDependencyFailure)
+			} else {
+				r.NoError(err)
+				r.Equal("https://example.org/dog.jpg", url)
+			}
+
+			r.Equal(ttCpy.expectedCalls, calls.Load())
+		})
+	}
+}
+
+func TestClientDeadline(t *testing.T) {
+	r := require.New(t)
+	srv, calls := newServer(t, 0)
+
+	client := newClient(srv.URL, dog.RetryConfig{
+		MaxRetries:      100,
+		AttemptTimeout:  20 * time.Millisecond,
+		Deadline:        100 * time.Millisecond,
+		InitialInterval: time.Millisecond,
+	}, gobreaker.Settings{})
+
+	start := time.Now()
+	_, err := client.GetRandomDogURL(context.Background())
+	r.ErrorIs(err, user.ErrDependencyFailure)
+	r.Less(time.Since(start), time.Second)
+	r.Less(calls.Load(), int32(10))
+}
+
+func TestClientRetriesCountOnceTowardsTheBreaker(t *testing.T) {
+	r := require.New(t)
+	srv, calls := newServer(t, http.StatusInternalServerError)
+
+	client := newClient(srv.URL, dog.RetryConfig{MaxRetries: 2, InitialInterval: time.Millisecond}, gobreaker.Settings{
+		ReadyToTrip: func(counts gobreaker.Counts) bool { return counts.ConsecutiveFailures >= 2 },
+	})
+
+	_, err := client.GetRandomDogURL(context.Background())
+	r.ErrorIs(err, user.ErrDependencyFailure)
+	r.Equal(int32(3), calls.Load())
+
+	_, err = client.GetRandomDogURL(context.Background())
+	r.ErrorIs(err, user.ErrDependencyFailure)
+	r.Equal(int32(6), calls.Load())
+
+	_, err = client.GetRandomDogURL(context.Background())
+	r.ErrorIs(err, user.ErrDependencyUnavailable)
+	r.Equal(int32(6), calls.Load())
+}
+
+func TestClientReportsCircuitBreakerState(t *testing.T) {
+	r := require.New(t)
+	srv, _ := newServer(t, http.StatusInternalServerError)
+
+	var changes []gobreaker.State
+
+	client := newClient(srv.URL, dog.RetryConfig{}, gobreaker.Settings{
+		Name:        "state-test",
+		ReadyToTrip: func(counts gobreaker.Counts) bool { return counts.ConsecutiveFailures >= 1 },
+		OnStateChange: func(_ string, _, to gobreaker.State) {
+			changes = append(changes, to)
+		},
+	})
+
+	r.Equal(float64(gobreaker.StateClosed), breakerState(t, "state-test"))
+
+	_, err := client.GetRandomDogURL(context.Background())
+	r.ErrorIs(err, user.ErrDependencyFailure)
+	r.Equal(float64(gobreaker.StateOpen), breakerState(t, "state-test"))
+	r.Equal([]gobreaker.State{gobreaker.StateOpen}, changes)
+}
+
+// breakerState reads the entdemo_dog_circuit_breaker_state gauge of the named breaker.
+func breakerState(t *testing.T, name string) float64 {
+	t.Helper()
+
+	state, ok := metricValue(t, "entdemo_dog_circuit_breaker_state", "name", name)
+	require.True(t, ok, "no circuit breaker state for %s", name)
+
+	return state
+}
+
+// metricValue reads the gauge or counter of the family whose label has the given value. It is not found until the
+// metric is first set.
+func metricValue(t *testing.T, family, labelName, labelValue string) (float64, bool) {
+	t.Helper()
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+
+	for _, f := range families {
+		if f.GetName() != family {
+			continue
+		}
+
+		for _, m := range f.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if label.GetName() != labelName || label.GetValue() != labelValue {
+					continue
+				}
+
+				if m.GetGauge() != nil {
+					return m.GetGauge().GetValue(), true
+				}
+
+				return m.GetCounter().GetValue(), true
+			}
+		}
+	}
+
+	return 0, false
+}
+
+// newURLServer answers with the given urls in order, and with the last one once they are exhausted.
+func newURLServer(t *testing.T, urls ...string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	calls := &atomic.Int32{}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := int(calls.Add(1))
+		_, _ = fmt.Fprintf(w, `{"url": %q}`, urls[min(call, len(urls))-1])
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, calls
+}
+
+func TestClientValidation(t *testing.T) {
+	validation := dog.ValidationConfig{
+		MaxBodySize:       100,
+		AllowedHosts:      []string{"example.org"},
+		AllowedExtensions: []string{".jpg", ".png"},
+		MaxRedraws:        2,
+	}
+
+	tests := []struct {
+		name          string
+		urls          []string
+		expectedURL   string
+		expectedCalls int32
+		expectedErr   error
+	}{
+		{name: "allowed", urls: []string{"https://cdn.example.org/dog.PNG"}, expectedURL: "https://cdn.example.org/dog.PNG",
+			expectedCalls: 1},
+		{name: "redraw", urls: []string{"https://example.org/dog.mp4", "https://example.org/dog.webm", "https://example.org/dog.jpg"},
+			expectedURL: "https://example.org/dog.jpg", expectedCalls: 3},
+		{name: "too many redraws", urls: []string{"https://example.org/dog.mp4"}, expectedCalls: 3,
+			expectedErr: dog.ErrDisallowedMedia},
+		{name: "insecure scheme", urls: []string{"http://example.org/dog.jpg"}, expectedCalls: 1, expectedErr: dog.ErrInvalidURL},
+		{name: "other host", urls: []string{"https://notexample.org/dog.jpg"}, expectedCalls: 1, expectedErr: dog.ErrInvalidURL},
+		{name: "no host", urls: []string{"/dog.jpg"}, expectedCalls: 1, expectedErr: dog.ErrInvalidURL},
+		{name: "too large", urls: []string{"https://example.org/" + strings.Repeat("a", 100) + ".jpg"}, expectedCalls: 1,
+			expectedErr: dog.ErrResponseTooLarge},
+	}
+
+	for _, tt := range tests {
+		ttCpy := tt
+		t.Run(tt.name, func(t *testing.T) {
+			r := require.New(t)
+			srv, calls := newURLServer(t, ttCpy.urls...)
+
+			client := dog.NewClient(dog.ClientConfig{Enabled: true, BaseURL: srv.URL, Validation: validation})
+
+			url, err := client.GetRandomDogURL(context.Background())
+			if ttCpy.expectedErr != nil {
+				r.ErrorIs(err, ttCpy.expectedErr)
+				r.ErrorIs(err, user.ErrDependencyFailure)
+			} else {
+				r.NoError(err)
+				r.Equal(ttCpy.expectedURL, url)
+			}
+
+			r.Equal(ttCpy.expectedCalls, calls.Load())
+		})
+	}
+}
+
+func TestClientDisallowedMediaDoesNotTripTheBreaker(t *testing.T) {
+	r := require.New(t)
+	srv, _ := newURLServer(t, "https://example.org/dog.mp4")
+
+	client := dog.NewClient(dog.ClientConfig{
+		Enabled:    true,
+		BaseURL:    srv.URL,
+		Validation: dog.ValidationConfig{AllowedExtensions: []string{".jpg"}},
+		CircuitBreakerSettings: gobreaker.Settings{
+			ReadyToTrip: func(counts gobreaker.Counts) bool { return counts.ConsecutiveFailures >= 1 },
+		},
+	})
+
+	for i := 0; i < 2; i++ {
+		_, err := client.GetRandomDogURL(context.Background())
+		r.True(errors.Is(err, dog.ErrDisallowedMedia), err)
+	}
+}
+
+func TestClientForwardsRequestID(t *testing.T) {
+	r := require.New(t)
+
+	received := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Get(requestid.Header)
+		_, _ = w.Write([]byte(`{"url": "https://example.org/dog.jpg"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	client := newClient(srv.URL, dog.RetryConfig{}, gobreaker.Settings{})
+
+	_, err := client.GetRandomDogURL(requestid.NewContext(context.Background(), "abc-123"))
+	r.NoError(err)
+	r.Equal("abc-123", <-received)
+
+	_, err = client.GetRandomDogURL(context.Background())
+	r.NoError(err)
+	r.Empty(<-received)
+}
+
+func TestClientErrorBodies(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		expectedErr error
+	}{
+		{name: "unexpected status", status: http.StatusNotFound, expectedErr: dog.ErrUnexpectedStatus},
+		{name: "malformed", status: http.StatusOK, expectedErr: dog.ErrMalformedResponse},
+	}
+
+	for _, tt := range tests {
+		ttCpy := tt
+		t.Run(tt.name, func(t *testing.T) {
+			r := require.New(t)
+
+			// larger than what the transport drains by itself
+			body := "<html>" + strings.Repeat("upstream page ", 300<<10/14) + "</html>"
+			connections := &atomic.Int32{}
+
+			srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(ttCpy.status)
+				_, _ = w.Write([]byte(body))
+			}))
+			srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+				if state == http.StateNew {
+					connections.Add(1)
+				}
+			}
+			srv.Start()
+			t.Cleanup(srv.Close)
+
+			client := dog.NewClient(dog.ClientConfig{
+				Enabled:    true,
+				BaseURL:    srv.URL,
+				Validation: dog.ValidationConfig{MaxBodySize: int64(len(body))},
+			})
+
+			for i := 0; i < 3; i++ {
+				_, err := client.GetRandomDogURL(context.Background())
+				r.ErrorIs(err, ttCpy.expectedErr)
+				// only the start of the body is quoted
+				r.Contains(err.Error(), `"<html>upstream page`)
+				r.Less(len(err.Error()), 300)
+			}
+
+			// the bodies are read to the end, so that the connection is reused
+			r.Equal(int32(1), connections.Load())
+		})
+	}
+}
@@ -0,0 +1,212 @@
+// Package dogtest provides a stub of the dog APIs, to exercise dog.Client end to end without the internet. The stub
+// answers the random.dog and dog.ceo paths from a configurable set of URLs, with scriptable latency, errors and
+// malformed payloads.
+package dogtest
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/goccy/go-json"
+)
+
+// Paths answered by Handler, matching the default paths of dog.APIRandomDog and dog.APIDogCEO.
+const (
+	PathRandomDog = "/woof.json"
+	PathDogCEO    = "/api/breeds/image/random"
+)
+
+// DefaultURLs are served when Config.URLs is empty.
+//
+//nolint:gochecknoglobals
+var DefaultURLs = []string{
+	"https://example.org/dogs/1.jpg",
+	"https://example.org/dogs/2.png",
+	"https://example.org/dogs/3.gif",
+}
+
+// MalformedBodies are the payloads served to the requests picked by Config.MalformedRate, in turn.
+//
+//nolint:gochecknoglobals
+var MalformedBodies = []string{
+	`{"url": "https://example.org/dogs/1.jpg"`,
+	`{}`,
+	`{"url": "not a url"}`,
+	`<html><body>Service Unavailable</body></html>`,
+}
+
+// Config scripts the behaviour of Handler. The zero value answers immediately with DefaultURLs.
+type Config struct {
+	// URLs are served in random order.
+	URLs []string
+	// Latency delays every answer. A random delay of up to LatencyJitter is added to it.
+	Latency       time.Duration
+	LatencyJitter time.Duration
+	// ErrorRate is the fraction, from 0 to 1, of the requests answered with ErrorStatus.
+	ErrorRate float64
+	// ErrorStatus defaults to 503.
+	ErrorStatus int
+	// MalformedRate is the fraction, from 0 to 1, of the requests answered with one of MalformedBodies.
+	MalformedRate float64
+	// Seed makes the random choices reproducible. Zero seeds from the clock.
+	Seed int64
+}
+
+// Stats counts the requests answered by Handler.
+type Stats struct {
+	Requests, Errors, Malformed uint64
+}
+
+// Handler is the http.Handler of the stub. Its configuration can be changed while it serves, e.g. to make the dog API
+// fail until a circuit breaker opens and then recover.
+type Handler struct {
+	mu     sync.Mutex
+	config Config
+	rand   *rand.Rand
+	next   int // of MalformedBodies
+
+	requests, errors, malformed atomic.Uint64
+}
+
+func NewHandler(config Config) *Handler {
+	h := &Handler{}
+	h.SetConfig(config)
+
+	return h
+}
+
+// SetConfig replaces the configuration of the handler. The random source is reseeded only if Config.Seed is set.
+func (h *Handler) SetConfig(config Config) {
+	if len(config.URLs) == 0 {
+		config.URLs = DefaultURLs
+	}
+
+	if config.ErrorStatus == 0 {
+		config.ErrorStatus = http.StatusServiceUnavailable
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.config = config
+
+	if config.Seed != 0 || h.rand == nil {
+		seed := config.Seed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+
+		h.rand = rand.New(rand.NewSource(seed)) //nolint:gosec
+	}
+}
+
+// Config returns the current configuration of the handler.
+func (h *Handler) Config() Config {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.config
+}
+
+// Stats returns the counters of the handler since it was created.
+func (h *Handler) Stats() Stats {
+	return Stats{Requests: h.requests.Load(), Errors: h.errors.Load(), Malformed: h.malformed.Load()}
+}
+
+type outcome struct {
+	delay     time.Duration
+	status    int
+	url       string
+	malformed string
+}
+
+// draw makes the random choices of a request.
+func (h *Handler) draw() outcome {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	o := outcome{delay: h.config.Latency, status: http.StatusOK}
+
+	if h.config.LatencyJitter > 0 {
+		o.delay += time.Duration(h.rand.Int63n(int64(h.config.LatencyJitter)))
+	}
+
+	switch p := h.rand.Float64(); {
+	case p < h.config.ErrorRate:
+		o.status = h.config.ErrorStatus
+	case p < h.config.ErrorRate+h.config.MalformedRate:
+		o.malformed = MalformedBodies[h.next%len(MalformedBodies)]
+		h.next++
+	default:
+		o.url = h.config.URLs[h.rand.Intn(len(h.config.URLs))]
+	}
+
+	return o
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if r.URL.Path != PathRandomDog && r.URL.Path != PathDogCEO {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	h.requests.Add(1)
+
+	o := h.draw()
+
+	if o.delay > 0 {
+		timer := time.NewTimer(o.delay)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	switch {
+	case o.status != http.StatusOK:
+		h.errors.Add(1)
+		w.WriteHeader(o.status)
+		_, _ = fmt.Fprintf(w, `{"error": %q}`, http.StatusText(o.status))
+	case o.malformed != "":
+		h.malformed.Add(1)
+		_, _ = w.Write([]byte(o.malformed))
+	default:
+		_ = json.NewEncoder(w).Encode(body(r.URL.Path, o.url))
+	}
+}
+
+func body(path, url string) any {
+	if path == PathDogCEO {
+		return map[string]string{"message": url, "status": "success"}
+	}
+
+	return map[string]string{"url": url}
+}
+
+// Server is a Handler listening on a local port, see httptest.Server.
+type Server struct {
+	*httptest.Server
+	Stub *Handler
+}
+
+// NewServer starts a stub. The caller should call Close when done.
+func NewServer(config Config) *Server {
+	h := NewHandler(config)
+
+	return &Server{Server: httptest.NewServer(h), Stub: h}
+}
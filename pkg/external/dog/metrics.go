@@ -0,0 +1,97 @@
+package dog
+
+import (
+	"errors"
+
+	"github.com/PopescuStefanRadu/ent-demo/pkg/user"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sony/gobreaker"
+)
+
+// Outcomes of the calls of Client, in the outcome label of the entdemo_dog_requests_total metric.
+const (
+	OutcomeSuccess = "success"
+	// OutcomeFailure means that the dog API failed, after the retries.
+	OutcomeFailure = "failure"
+	// OutcomeRejected means that the circuit breaker did not let the call through.
+	OutcomeRejected = "rejected"
+)
+
+// Results of the calls of PrefetchPool, in the result label of the entdemo_dog_prefetch_takes_total metric.
+const (
+	// PrefetchHit means that the URL was served from the pool.
+	PrefetchHit = "hit"
+	// PrefetchMiss means that the pool was empty and the upstream was called.
+	PrefetchMiss = "miss"
+	// PrefetchExpired counts the URLs of the pool dropped because they were older than PrefetchConfig.MaxAge.
+	PrefetchExpired = "expired"
+)
+
+//nolint:gochecknoglobals
+var (
+	requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "entdemo",
+		Subsystem: "dog",
+		Name:      "requests_total",
+		Help:      "Calls of the dog API, by API and outcome: success, failure or rejected by the circuit breaker.",
+	}, []string{"api", "outcome"})
+
+	circuitBreakerState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "entdemo",
+		Subsystem: "dog",
+		Name:      "circuit_breaker_state",
+		Help:      "State of the circuit breakers of the dog API, by name: 0 closed, 1 half-open, 2 open.",
+	}, []string{"name"})
+
+	prefetchTakesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "entdemo",
+		Subsystem: "dog",
+		Name:      "prefetch_takes_total",
+		Help:      "URLs asked to the prefetch pool, by result: hit, miss, or expired URL dropped from the pool.",
+	}, []string{"result"})
+
+	prefetchRefillsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "entdemo",
+		Subsystem: "dog",
+		Name:      "prefetch_refills_total",
+		Help:      "Fetches made to refill the prefetch pool, by outcome: success or failure.",
+	}, []string{"outcome"})
+
+	prefetchURLs = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "entdemo",
+		Subsystem: "dog",
+		Name:      "prefetch_urls",
+		Help:      "URLs ready in the prefetch pool.",
+	})
+)
+
+// observeStateChanges feeds the circuit_breaker_state gauge from the OnStateChange callback of settings, and still
+// calls the callback that was already set.
+func observeStateChanges(settings gobreaker.Settings) gobreaker.Settings {
+	circuitBreakerState.WithLabelValues(settings.Name).Set(float64(gobreaker.StateClosed))
+
+	onStateChange := settings.OnStateChange
+	settings.OnStateChange = func(name string, from, to gobreaker.State) {
+		circuitBreakerState.WithLabelValues(name).Set(float64(to))
+
+		if onStateChange != nil {
+			onStateChange(name, from, to)
+		}
+	}
+
+	return settings
+}
+
+func observeOutcome(api API, err error) {
+	outcome := OutcomeSuccess
+
+	switch {
+	case errors.Is(err, user.ErrDependencyUnavailable):
+		outcome = OutcomeRejected
+	case err != nil:
+		outcome = OutcomeFailure
+	}
+
+	requestsTotal.WithLabelValues(string(api), outcome).Inc()
+}
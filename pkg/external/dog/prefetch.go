@@ -0,0 +1,177 @@
+package dog
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/PopescuStefanRadu/ent-demo/pkg/user"
+	"github.com/cenkalti/backoff/v4"
+	"github.com/rs/zerolog"
+)
+
+// PrefetchConfig configures PrefetchPool. Prefetching is disabled when Size is not positive.
+type PrefetchConfig struct {
+	// Size is the number of URLs kept ready in the pool.
+	Size int
+	// MaxAge is how long a prefetched URL can be served. Older URLs are dropped when taken. Zero keeps URLs forever.
+	MaxAge time.Duration
+	// InitialInterval is the wait before refilling again after a failure. It grows exponentially, with jitter, while
+	// the upstream keeps failing, e.g. because its circuit breaker is open.
+	InitialInterval time.Duration
+	// MaxInterval caps the wait between two failed refills.
+	MaxInterval time.Duration
+}
+
+// PrefetchStats counts the activity of a PrefetchPool since it was created. The pools also report their activity in the
+// entdemo_dog_prefetch_* metrics.
+type PrefetchStats struct {
+	// Len is the number of URLs currently in the pool.
+	Len int
+	// Hits and Misses count the calls answered from the pool and the ones that had to ask the upstream.
+	Hits, Misses uint64
+	// Expired counts the URLs dropped because they were older than PrefetchConfig.MaxAge.
+	Expired uint64
+	// Refills and RefillFailures count the fetches made by the background worker.
+	Refills, RefillFailures uint64
+}
+
+// PrefetchPool decorates a user.Dog with a buffer of URLs that a background worker, started with Run, keeps filled.
+// Calls take a URL from the buffer without waiting, and only ask the upstream when the buffer is empty.
+type PrefetchPool struct {
+	Upstream user.Dog
+	Config   PrefetchConfig
+
+	urls chan prefetchedURL
+	now  func() time.Time
+
+	hits, misses, expired, refills, refillFailures atomic.Uint64
+}
+
+type prefetchedURL struct {
+	url       string
+	fetchedAt time.Time
+}
+
+func NewPrefetchPool(upstream user.Dog, config PrefetchConfig) *PrefetchPool {
+	return &PrefetchPool{
+		Upstream: upstream,
+		Config:   config,
+		urls:     make(chan prefetchedURL, max(config.Size, 0)),
+		now:      time.Now,
+	}
+}
+
+func (p *PrefetchPool) GetRandomDogURL(ctx context.Context) (string, error) {
+	for {
+		select {
+		case u := <-p.urls:
+			prefetchURLs.Dec()
+
+			if p.Config.MaxAge > 0 && p.now().Sub(u.fetchedAt) >= p.Config.MaxAge {
+				p.expired.Add(1)
+				prefetchTakesTotal.WithLabelValues(PrefetchExpired).Inc()
+
+				continue
+			}
+
+			p.hits.Add(1)
+			prefetchTakesTotal.WithLabelValues(PrefetchHit).Inc()
+
+			return u.url, nil
+		default:
+			p.misses.Add(1)
+			prefetchTakesTotal.WithLabelValues(PrefetchMiss).Inc()
+
+			return p.Upstream.GetRandomDogURL(ctx)
+		}
+	}
+}
+
+// Run refills the pool until ctx is canceled. Failed refills are retried with an exponential backoff.
+func (p *PrefetchPool) Run(ctx context.Context) {
+	l := zerolog.Ctx(ctx)
+	b := p.backOff()
+
+	for {
+		url, err := p.Upstream.GetRandomDogURL(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			p.refillFailures.Add(1)
+			prefetchRefillsTotal.WithLabelValues(OutcomeFailure).Inc()
+
+			wait := b.NextBackOff()
+			if errors.Is(err, user.ErrDependencyUnavailable) {
+				l.Debug().Err(err).Msgf("PrefetchPool: upstream unavailable, refilling again in %s", wait)
+			} else {
+				l.Warn().Err(err).Msgf("PrefetchPool: refill failed, refilling again in %s", wait)
+			}
+
+			if !sleep(ctx, wait) {
+				return
+			}
+
+			continue
+		}
+
+		b.Reset()
+		p.refills.Add(1)
+		prefetchRefillsTotal.WithLabelValues(OutcomeSuccess).Inc()
+
+		// counted before it is added, so that a concurrent take never brings the gauge below zero
+		prefetchURLs.Inc()
+
+		select {
+		case p.urls <- prefetchedURL{url: url, fetchedAt: p.now()}:
+		case <-ctx.Done():
+			prefetchURLs.Dec()
+			return
+		}
+	}
+}
+
+func (p *PrefetchPool) backOff() *backoff.ExponentialBackOff {
+	b := backoff.NewExponentialBackOff()
+	b.MaxElapsedTime = 0
+
+	if p.Config.InitialInterval > 0 {
+		b.InitialInterval = p.Config.InitialInterval
+	}
+
+	if p.Config.MaxInterval > 0 {
+		b.MaxInterval = p.Config.MaxInterval
+	}
+
+	b.Reset()
+
+	return b
+}
+
+// Stats returns a snapshot of the counters of the pool.
+func (p *PrefetchPool) Stats() PrefetchStats {
+	return PrefetchStats{
+		Len:            len(p.urls),
+		Hits:           p.hits.Load(),
+		Misses:         p.misses.Load(),
+		Expired:        p.expired.Load(),
+		Refills:        p.refills.Load(),
+		RefillFailures: p.refillFailures.Load(),
+	}
+}
+
+// sleep waits for d, returning false if ctx is canceled first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
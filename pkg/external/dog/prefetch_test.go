@@ -0,0 +1,132 @@
+package dog_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PopescuStefanRadu/ent-demo/pkg/external/dog"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/user"
+	mockUser "github.com/PopescuStefanRadu/ent-demo/pkg/user/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func runPool(t *testing.T, pool *dog.PrefetchPool) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+		pool.Run(ctx)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+	})
+}
+
+func TestPrefetchPoolServesFromPool(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	upstream := mockUser.NewMockDog(gomock.NewController(t))
+
+	upstream.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org/1.jpg", nil).MinTimes(2)
+
+	hits, _ := metricValue(t, "entdemo_dog_prefetch_takes_total", "result", dog.PrefetchHit)
+	refills, _ := metricValue(t, "entdemo_dog_prefetch_refills_total", "outcome", dog.OutcomeSuccess)
+
+	pool := dog.NewPrefetchPool(upstream, dog.PrefetchConfig{Size: 2})
+	runPool(t, pool)
+
+	r.Eventually(func() bool { return pool.Stats().Len == 2 }, time.Second, time.Millisecond)
+
+	url, err := pool.GetRandomDogURL(ctx)
+	r.NoError(err)
+	r.Equal("https://example.org/1.jpg", url)
+
+	stats := pool.Stats()
+	r.Equal(uint64(1), stats.Hits)
+	r.Equal(uint64(0), stats.Misses)
+	r.GreaterOrEqual(stats.Refills, uint64(2))
+
+	// the activity is reported in the metrics too
+	metricHits, _ := metricValue(t, "entdemo_dog_prefetch_takes_total", "result", dog.PrefetchHit)
+	r.Equal(hits+1, metricHits)
+
+	metricRefills, _ := metricValue(t, "entdemo_dog_prefetch_refills_total", "outcome", dog.OutcomeSuccess)
+	r.GreaterOrEqual(metricRefills, refills+2)
+}
+
+func TestPrefetchPoolFallsBackToUpstreamWhenEmpty(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	upstream := mockUser.NewMockDog(gomock.NewController(t))
+
+	upstream.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org/1.jpg", nil)
+
+	// not running, so it stays empty
+	pool := dog.NewPrefetchPool(upstream, dog.PrefetchConfig{Size: 2})
+
+	url, err := pool.GetRandomDogURL(ctx)
+	r.NoError(err)
+	r.Equal("https://example.org/1.jpg", url)
+	r.Equal(uint64(1), pool.Stats().Misses)
+}
+
+func TestPrefetchPoolBacksOffWhileUpstreamFails(t *testing.T) {
+	r := require.New(t)
+	upstream := mockUser.NewMockDog(gomock.NewController(t))
+
+	upstream.EXPECT().GetRandomDogURL(gomock.Any()).Return("", user.ErrDependencyUnavailable).AnyTimes()
+
+	pool := dog.NewPrefetchPool(upstream, dog.PrefetchConfig{
+		Size:            2,
+		InitialInterval: 20 * time.Millisecond,
+		MaxInterval:     40 * time.Millisecond,
+	})
+	runPool(t, pool)
+
+	time.Sleep(150 * time.Millisecond)
+
+	stats := pool.Stats()
+	r.Equal(0, stats.Len)
+	r.GreaterOrEqual(stats.RefillFailures, uint64(2))
+	// without backoff, the worker would have called the upstream continuously
+	r.LessOrEqual(stats.RefillFailures, uint64(10))
+}
+
+func TestPrefetchPoolDropsExpiredURLs(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	upstream := mockUser.NewMockDog(gomock.NewController(t))
+
+	gomock.InOrder(
+		upstream.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org/old.jpg", nil),
+		upstream.EXPECT().GetRandomDogURL(gomock.Any()).Return("", user.ErrDependencyUnavailable).AnyTimes(),
+	)
+
+	pool := dog.NewPrefetchPool(upstream, dog.PrefetchConfig{
+		Size:            1,
+		MaxAge:          50 * time.Millisecond,
+		InitialInterval: time.Hour,
+	})
+	runPool(t, pool)
+
+	r.Eventually(func() bool { return pool.Stats().Len == 1 }, time.Second, time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+
+	_, err := pool.GetRandomDogURL(ctx)
+	r.ErrorIs(err, user.ErrDependencyUnavailable)
+
+	stats := pool.Stats()
+	r.Equal(uint64(1), stats.Expired)
+	r.Equal(uint64(1), stats.Misses)
+}
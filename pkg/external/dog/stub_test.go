@@ -0,0 +1,88 @@
+package dog_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/PopescuStefanRadu/ent-demo/pkg/external/dog"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/external/dog/dogtest"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/user"
+	"github.com/sony/gobreaker"
+	"github.com/stretchr/testify/require"
+)
+
+func newStub(t *testing.T, config dogtest.Config) *dogtest.Server {
+	t.Helper()
+
+	srv := dogtest.NewServer(config)
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestClientAgainstStub(t *testing.T) {
+	for _, api := range []dog.API{dog.APIRandomDog, dog.APIDogCEO} {
+		apiCpy := api
+		t.Run(string(api), func(t *testing.T) {
+			r := require.New(t)
+			srv := newStub(t, dogtest.Config{URLs: []string{"https://example.org/dog.jpg"}})
+
+			client := dog.NewClient(dog.ClientConfig{Enabled: true, API: apiCpy, BaseURL: srv.URL})
+
+			url, err := client.GetRandomDogURL(context.Background())
+			r.NoError(err)
+			r.Equal("https://example.org/dog.jpg", url)
+		})
+	}
+}
+
+func TestClientAgainstMalformedStub(t *testing.T) {
+	r := require.New(t)
+	srv := newStub(t, dogtest.Config{MalformedRate: 1})
+
+	client := dog.NewClient(dog.ClientConfig{Enabled: true, BaseURL: srv.URL})
+
+	for range dogtest.MalformedBodies {
+		_, err := client.GetRandomDogURL(context.Background())
+		r.ErrorIs(err, user.ErrDependencyFailure)
+	}
+
+	r.Equal(uint64(len(dogtest.MalformedBodies)), srv.Stub.Stats().Malformed)
+}
+
+func TestBreakerOpensAndRecoversAgainstStub(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	srv := newStub(t, dogtest.Config{ErrorRate: 1, Seed: 1})
+
+	client := dog.NewClient(dog.ClientConfig{
+		Enabled: true,
+		BaseURL: srv.URL,
+		CircuitBreakerSettings: gobreaker.Settings{
+			Timeout: 50 * time.Millisecond,
+			ReadyToTrip: func(counts gobreaker.Counts) bool {
+				return counts.ConsecutiveFailures >= 3
+			},
+		},
+		Retry: dog.RetryConfig{MaxRetries: 1, InitialInterval: time.Millisecond},
+	})
+
+	for i := 0; i < 3; i++ {
+		_, err := client.GetRandomDogURL(ctx)
+		r.ErrorIs(err, user.ErrDependencyFailure)
+	}
+
+	r.Equal(uint64(6), srv.Stub.Stats().Requests)
+
+	_, err := client.GetRandomDogURL(ctx)
+	r.ErrorIs(err, user.ErrDependencyUnavailable)
+	r.Equal(uint64(6), srv.Stub.Stats().Requests)
+
+	srv.Stub.SetConfig(dogtest.Config{Latency: 10 * time.Millisecond})
+	time.Sleep(50 * time.Millisecond)
+
+	url, err := client.GetRandomDogURL(ctx)
+	r.NoError(err)
+	r.Contains(dogtest.DefaultURLs, url)
+}
@@ -0,0 +1,110 @@
+package dog
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+)
+
+// DefaultMaxBodySize is the default of ValidationConfig.MaxBodySize.
+const DefaultMaxBodySize = 64 << 10
+
+var (
+	ErrResponseTooLarge = errors.New("GetRandomDogURL: response too large")
+	ErrInvalidURL       = errors.New("GetRandomDogURL: invalid url")
+	ErrDisallowedMedia  = errors.New("GetRandomDogURL: disallowed media type")
+)
+
+// StatusError is returned when the API answers with a status other than 200 OK. It matches ErrUnexpectedStatus.
+type StatusError struct {
+	StatusCode int
+	// Body is the start of the response body.
+	Body string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s: %d: body %q", ErrUnexpectedStatus, e.StatusCode, e.Body)
+}
+
+func (e *StatusError) Is(target error) bool {
+	return target == ErrUnexpectedStatus //nolint:errorlint,goerr113
+}
+
+// ValidationConfig restricts the responses that Client accepts.
+type ValidationConfig struct {
+	// MaxBodySize is the largest response body read, in bytes. Defaults to DefaultMaxBodySize.
+	MaxBodySize int64
+	// AllowedSchemes defaults to https only.
+	AllowedSchemes []string
+	// AllowedHosts lists the hosts that URLs can point to, subdomains included. Empty allows any host.
+	AllowedHosts []string
+	// AllowedExtensions lists the file extensions that URLs can have, e.g. ".jpg". The comparison ignores case.
+	// Empty allows any extension.
+	AllowedExtensions []string
+	// MaxRedraws is how many times a new URL is requested when one has a disallowed extension.
+	MaxRedraws int
+}
+
+func (v ValidationConfig) withDefaults() ValidationConfig {
+	if v.MaxBodySize <= 0 {
+		v.MaxBodySize = DefaultMaxBodySize
+	}
+
+	if len(v.AllowedSchemes) == 0 {
+		v.AllowedSchemes = []string{"https"}
+	}
+
+	return v
+}
+
+// validateURL checks the scheme and host of a URL. Its extension is checked separately by allowedMedia, as a
+// disallowed extension is worth another draw.
+func (v ValidationConfig) validateURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidURL, err)
+	}
+
+	if !slices.Contains(v.AllowedSchemes, strings.ToLower(u.Scheme)) {
+		return fmt.Errorf("%w: scheme of %q is not one of %v", ErrInvalidURL, rawURL, v.AllowedSchemes)
+	}
+
+	if u.Hostname() == "" {
+		return fmt.Errorf("%w: %q has no host", ErrInvalidURL, rawURL)
+	}
+
+	if len(v.AllowedHosts) == 0 {
+		return nil
+	}
+
+	host := strings.ToLower(u.Hostname())
+
+	for _, allowed := range v.AllowedHosts {
+		allowed = strings.ToLower(allowed)
+		if host == allowed || strings.HasSuffix(host, "."+allowed) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: host of %q is not one of %v", ErrInvalidURL, rawURL, v.AllowedHosts)
+}
+
+func (v ValidationConfig) allowedMedia(rawURL string) bool {
+	if len(v.AllowedExtensions) == 0 {
+		return true
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+
+	ext := path.Ext(u.Path)
+
+	return slices.ContainsFunc(v.AllowedExtensions, func(allowed string) bool {
+		return strings.EqualFold(ext, allowed)
+	})
+}
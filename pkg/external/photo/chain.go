@@ -0,0 +1,125 @@
+package photo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+
+	"github.com/PopescuStefanRadu/ent-demo/pkg/user"
+)
+
+// ChainMode decides the order in which Chain tries its providers.
+type ChainMode string
+
+const (
+	// ChainFallback tries the providers in the configured order. It is the default.
+	ChainFallback ChainMode = "fallback"
+	// ChainWeighted tries the providers in a random order, in which a provider comes first with a probability
+	// proportional to its weight.
+	ChainWeighted ChainMode = "weighted"
+)
+
+type ChainConfig struct {
+	Mode  ChainMode
+	Links []ChainLink
+}
+
+type ChainLink struct {
+	// Weight is only used by ChainWeighted, and defaults to 1.
+	Weight   int
+	Provider ProviderConfig
+}
+
+type weightedProvider struct {
+	weight   int
+	provider user.Dog
+}
+
+// Chain asks its providers in turn until one of them answers.
+type Chain struct {
+	Mode      ChainMode
+	providers []weightedProvider
+}
+
+// NewChain builds the providers of the links, with New.
+func NewChain(config ChainConfig) (*Chain, error) {
+	mode := config.Mode
+	if mode == "" {
+		mode = ChainFallback
+	}
+
+	if mode != ChainFallback && mode != ChainWeighted {
+		return nil, fmt.Errorf("unknown chain mode %q", mode)
+	}
+
+	if len(config.Links) == 0 {
+		return nil, errors.New("chain has no providers")
+	}
+
+	chain := &Chain{Mode: mode, providers: make([]weightedProvider, len(config.Links))}
+
+	for i, link := range config.Links {
+		if link.Weight < 0 {
+			return nil, fmt.Errorf("link %d: negative weight %d", i, link.Weight)
+		}
+
+		provider, err := New(link.Provider)
+		if err != nil {
+			return nil, fmt.Errorf("link %d: %w", i, err)
+		}
+
+		chain.providers[i] = weightedProvider{weight: max(link.Weight, 1), provider: provider}
+	}
+
+	return chain, nil
+}
+
+// GetRandomDogURL returns the URL of the first provider that answers. If none does, the error lists the failure of
+// each provider.
+func (c *Chain) GetRandomDogURL(ctx context.Context) (string, error) {
+	var errs []error
+
+	for _, p := range c.order() {
+		url, err := p.provider.GetRandomDogURL(ctx)
+		if err == nil {
+			return url, nil
+		}
+
+		errs = append(errs, err)
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return "", errors.Join(errs...)
+}
+
+func (c *Chain) order() []weightedProvider {
+	if c.Mode == ChainFallback {
+		return c.providers
+	}
+
+	remaining := append([]weightedProvider{}, c.providers...)
+	ordered := make([]weightedProvider, 0, len(remaining))
+
+	for len(remaining) > 0 {
+		total := 0
+		for _, p := range remaining {
+			total += p.weight
+		}
+
+		pick := rand.Intn(total) //nolint:gosec // not used for security
+
+		i := 0
+		for ; pick >= remaining[i].weight; i++ {
+			pick -= remaining[i].weight
+		}
+
+		ordered = append(ordered, remaining[i])
+		remaining = append(remaining[:i], remaining[i+1:]...)
+	}
+
+	return ordered
+}
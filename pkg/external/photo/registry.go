@@ -0,0 +1,120 @@
+// Package photo builds the user.Dog implementation selected by configuration. Several providers are built in, and
+// others can be added with Register.
+package photo
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/PopescuStefanRadu/ent-demo/pkg/external/dog"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/user"
+)
+
+// Built-in provider types.
+const (
+	// TypeNone serves empty URLs. It is the default.
+	TypeNone = "none"
+	// TypeRandomDog fetches from a random.dog style API, configured by ProviderConfig.HTTP.
+	TypeRandomDog = "random.dog"
+	// TypeDogCEO fetches from a dog.ceo style API, configured by ProviderConfig.HTTP.
+	TypeDogCEO = "dog.ceo"
+	// TypeStatic serves URLs from a local file, configured by ProviderConfig.Static.
+	TypeStatic = "static"
+	// TypeChain combines other providers, configured by ProviderConfig.Chain.
+	TypeChain = "chain"
+)
+
+// ProviderConfig selects a provider by Type. Only the section of the selected type is read.
+type ProviderConfig struct {
+	Type   string
+	HTTP   dog.ClientConfig
+	Static StaticConfig
+	Chain  ChainConfig
+}
+
+// Factory builds a provider from its configuration.
+type Factory func(config ProviderConfig) (user.Dog, error)
+
+//nolint:gochecknoglobals
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{}
+)
+
+//nolint:gochecknoinits
+func init() {
+	Register(TypeNone, func(ProviderConfig) (user.Dog, error) {
+		return dog.NoOpClient{}, nil
+	})
+	Register(TypeRandomDog, newHTTPFactory(dog.APIRandomDog))
+	Register(TypeDogCEO, newHTTPFactory(dog.APIDogCEO))
+	Register(TypeStatic, func(config ProviderConfig) (user.Dog, error) {
+		return NewStatic(config.Static)
+	})
+	Register(TypeChain, func(config ProviderConfig) (user.Dog, error) {
+		return NewChain(config.Chain)
+	})
+}
+
+// Register makes a provider type available to New. It replaces any factory already registered for the type.
+func Register(providerType string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	registry[providerType] = factory
+}
+
+// Types lists the registered provider types.
+func Types() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	types := make([]string, 0, len(registry))
+	for t := range registry {
+		types = append(types, t)
+	}
+
+	sort.Strings(types)
+
+	return types
+}
+
+// New builds the provider selected by config.Type, TypeNone if empty.
+//
+//nolint:ireturn
+func New(config ProviderConfig) (user.Dog, error) {
+	providerType := config.Type
+	if providerType == "" {
+		providerType = TypeNone
+	}
+
+	registryMu.RLock()
+	factory, ok := registry[providerType]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown photo provider %q, expected one of %v", providerType, Types())
+	}
+
+	provider, err := factory(config)
+	if err != nil {
+		return nil, fmt.Errorf("could not create photo provider %q: %w", providerType, err)
+	}
+
+	return provider, nil
+}
+
+func newHTTPFactory(api dog.API) Factory {
+	return func(config ProviderConfig) (user.Dog, error) {
+		httpConfig := config.HTTP
+		httpConfig.Enabled = true
+		httpConfig.API = api
+
+		if httpConfig.BaseURL == "" {
+			return nil, fmt.Errorf("missing base url")
+		}
+
+		return dog.NewClient(httpConfig), nil
+	}
+}
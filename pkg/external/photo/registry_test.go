@@ -0,0 +1,156 @@
+package photo_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/PopescuStefanRadu/ent-demo/pkg/external/dog"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/external/photo"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/user"
+	"github.com/stretchr/testify/require"
+)
+
+type fixedProvider struct {
+	url string
+	err error
+}
+
+func (p fixedProvider) GetRandomDogURL(context.Context) (string, error) {
+	return p.url, p.err
+}
+
+//nolint:gochecknoinits
+func init() {
+	// the url of a "fixed" provider is its base url, and an empty one fails
+	photo.Register("fixed", func(config photo.ProviderConfig) (user.Dog, error) {
+		if config.HTTP.BaseURL == "" {
+			return fixedProvider{err: user.ErrDependencyUnavailable}, nil
+		}
+
+		return fixedProvider{url: config.HTTP.BaseURL}, nil
+	})
+}
+
+func fixed(url string, weight int) photo.ChainLink {
+	return photo.ChainLink{Weight: weight, Provider: photo.ProviderConfig{Type: "fixed", HTTP: dog.ClientConfig{BaseURL: url}}}
+}
+
+func TestNew(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	provider, err := photo.New(photo.ProviderConfig{})
+	r.NoError(err)
+
+	url, err := provider.GetRandomDogURL(ctx)
+	r.NoError(err)
+	r.Empty(url)
+
+	_, err = photo.New(photo.ProviderConfig{Type: "cats"})
+	r.ErrorContains(err, "unknown photo provider")
+
+	_, err = photo.New(photo.ProviderConfig{Type: photo.TypeRandomDog})
+	r.ErrorContains(err, "missing base url")
+}
+
+func TestDogCEO(t *testing.T) {
+	r := require.New(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/api/breeds/image/random" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"message": "https://images.example.org/husky.jpg", "status": "success"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	provider, err := photo.New(photo.ProviderConfig{Type: photo.TypeDogCEO, HTTP: dog.ClientConfig{BaseURL: srv.URL}})
+	r.NoError(err)
+
+	url, err := provider.GetRandomDogURL(context.Background())
+	r.NoError(err)
+	r.Equal("https://images.example.org/husky.jpg", url)
+}
+
+func TestStatic(t *testing.T) {
+	r := require.New(t)
+	dir := t.TempDir()
+
+	file := filepath.Join(dir, "urls.txt")
+	r.NoError(os.WriteFile(file, []byte("# cats\nhttps://example.org/1.jpg\n\n  https://example.org/2.jpg  \n"), 0o600))
+
+	provider, err := photo.New(photo.ProviderConfig{Type: photo.TypeStatic, Static: photo.StaticConfig{File: file}})
+	r.NoError(err)
+
+	for i := 0; i < 10; i++ {
+		url, err := provider.GetRandomDogURL(context.Background())
+		r.NoError(err)
+		r.Contains([]string{"https://example.org/1.jpg", "https://example.org/2.jpg"}, url)
+	}
+
+	empty := filepath.Join(dir, "empty.txt")
+	r.NoError(os.WriteFile(empty, []byte("# nothing\n"), 0o600))
+
+	_, err = photo.New(photo.ProviderConfig{Type: photo.TypeStatic, Static: photo.StaticConfig{File: empty}})
+	r.ErrorIs(err, photo.ErrNoURLs)
+
+	_, err = photo.New(photo.ProviderConfig{Type: photo.TypeStatic, Static: photo.StaticConfig{File: filepath.Join(dir, "missing")}})
+	r.ErrorIs(err, os.ErrNotExist)
+}
+
+func TestChainFallback(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	provider, err := photo.New(photo.ProviderConfig{Type: photo.TypeChain, Chain: photo.ChainConfig{
+		Links: []photo.ChainLink{fixed("", 0), fixed("https://example.org/2.jpg", 0), fixed("https://example.org/3.jpg", 0)},
+	}})
+	r.NoError(err)
+
+	url, err := provider.GetRandomDogURL(ctx)
+	r.NoError(err)
+	r.Equal("https://example.org/2.jpg", url)
+
+	provider, err = photo.New(photo.ProviderConfig{Type: photo.TypeChain, Chain: photo.ChainConfig{
+		Links: []photo.ChainLink{fixed("", 0), fixed("", 0)},
+	}})
+	r.NoError(err)
+
+	_, err = provider.GetRandomDogURL(ctx)
+	r.ErrorIs(err, user.ErrDependencyUnavailable)
+
+	_, err = photo.New(photo.ProviderConfig{Type: photo.TypeChain, Chain: photo.ChainConfig{
+		Links: []photo.ChainLink{{Provider: photo.ProviderConfig{Type: "cats"}}},
+	}})
+	r.ErrorContains(err, "link 0")
+}
+
+func TestChainWeighted(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	provider, err := photo.New(photo.ProviderConfig{Type: photo.TypeChain, Chain: photo.ChainConfig{
+		Mode:  photo.ChainWeighted,
+		Links: []photo.ChainLink{fixed("https://example.org/1.jpg", 1), fixed("https://example.org/9.jpg", 9), fixed("", 90)},
+	}})
+	r.NoError(err)
+
+	counts := map[string]int{}
+
+	for i := 0; i < 1000; i++ {
+		url, err := provider.GetRandomDogURL(ctx)
+		r.NoError(err)
+
+		counts[url]++
+	}
+
+	r.Len(counts, 2, fmt.Sprint(counts))
+	r.Greater(counts["https://example.org/9.jpg"], counts["https://example.org/1.jpg"])
+}
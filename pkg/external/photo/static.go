@@ -0,0 +1,58 @@
+package photo
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+)
+
+var ErrNoURLs = errors.New("no urls")
+
+type StaticConfig struct {
+	// File lists one URL per line. Blank lines and lines starting with '#' are ignored.
+	File string
+}
+
+// Static serves random URLs from a fixed list.
+type Static struct {
+	URLs []string
+}
+
+// NewStatic reads the URLs of config.File.
+func NewStatic(config StaticConfig) (*Static, error) {
+	f, err := os.Open(config.File)
+	if err != nil {
+		return nil, fmt.Errorf("could not open url list: %w", err)
+	}
+	defer f.Close()
+
+	static := &Static{}
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		static.URLs = append(static.URLs, line)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read url list: %w", err)
+	}
+
+	if len(static.URLs) == 0 {
+		return nil, fmt.Errorf("%w in %s", ErrNoURLs, config.File)
+	}
+
+	return static, nil
+}
+
+func (s *Static) GetRandomDogURL(context.Context) (string, error) {
+	return s.URLs[rand.Intn(len(s.URLs))], nil //nolint:gosec // not used for security
+}
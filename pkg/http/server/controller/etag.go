@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/PopescuStefanRadu/ent-demo/pkg/http/server/response"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	headerETag    = "ETag"
+	headerIfMatch = "If-Match"
+)
+
+func setETag(c *gin.Context, version int) {
+	c.Header(headerETag, strconv.Quote(strconv.Itoa(version)))
+}
+
+// ifMatchVersion returns the version required by the If-Match header, or 0 if any version matches ("*"). It fails if
+// the header is missing, and returns -1, which matches no version, when it lists no entity tag of ours. When it lists
+// several versions, current is called for the version of the resource, which is required if listed.
+func ifMatchVersion(c *gin.Context, current func() (int, error)) (int, error) {
+	header := strings.TrimSpace(c.GetHeader(headerIfMatch))
+	if header == "" {
+		return 0, &response.Error{
+			Path:    headerIfMatch,
+			Status:  http.StatusPreconditionRequired,
+			Code:    "PreconditionRequired",
+			Message: fmt.Sprintf("the %s header is required", headerIfMatch),
+		}
+	}
+
+	if header == "*" {
+		return 0, nil
+	}
+
+	var versions []int
+
+	for _, tag := range strings.Split(header, ",") {
+		// weak, malformed and foreign tags never match
+		if version, ok := parseETag(strings.TrimSpace(tag)); ok {
+			versions = append(versions, version)
+		}
+	}
+
+	switch len(versions) {
+	case 0:
+		return -1, nil
+	case 1:
+		return versions[0], nil
+	}
+
+	version, err := current()
+	if err != nil {
+		return 0, err
+	}
+
+	if !slices.Contains(versions, version) {
+		return -1, nil
+	}
+
+	return version, nil
+}
+
+func parseETag(tag string) (int, bool) {
+	unquoted, err := strconv.Unquote(tag)
+	if err != nil || !strings.HasPrefix(tag, `"`) {
+		return 0, false
+	}
+
+	version, err := strconv.Atoi(unquoted)
+	if err != nil || version <= 0 {
+		return 0, false
+	}
+
+	return version, true
+}
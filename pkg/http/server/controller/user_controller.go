@@ -1,7 +1,9 @@
 package controller
 
 import (
+	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/PopescuStefanRadu/ent-demo/pkg/http/server/request"
 	"github.com/PopescuStefanRadu/ent-demo/pkg/http/server/response"
@@ -19,16 +21,17 @@ func (ctl *User) Get(c *gin.Context) {
 	}{}
 
 	if err := c.ShouldBindUri(&q); err != nil {
-		_ = c.Error(err)
+		_ = c.Error(err).SetType(gin.ErrorTypeBind)
 		return
 	}
 
-	res, err := ctl.UserService.GetUserByID(c, q.ID)
+	res, err := ctl.UserService.GetUserByID(c.Request.Context(), q.ID)
 	if err != nil {
 		_ = c.Error(err)
 		return
 	}
 
+	setETag(c, res.Version)
 	c.JSON(http.StatusOK, response.Response[response.User]{Result: response.User(*res)})
 }
 
@@ -36,19 +39,81 @@ func (ctl *User) Create(c *gin.Context) {
 	var q request.CreateUser
 
 	if err := c.ShouldBind(&q); err != nil {
+		_ = c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	u := user.CreateUserParams{Username: q.Username, Email: q.Email}
+
+	created, warning, err := ctl.UserService.CreateUser(c.Request.Context(), &u)
+	if err != nil {
 		_ = c.Error(err)
 		return
 	}
 
-	u := user.CreateUserParams(q)
+	resp := response.Response[response.User]{Result: response.User(*created)}
+
+	// the user was created without photo
+	if warning != nil {
+		_, w := response.FromBusinessError(warning)
+		resp.Warnings = map[string][]response.Error{"global": {w}}
+	}
+
+	setETag(c, created.Version)
+	c.JSON(http.StatusOK, resp)
+}
+
+// CreateBatch answers with one result per requested user, in the same order. In best effort mode a failed item has a
+// null result and its errors are reported under the path of the item. Users created without a photo have a warning
+// under the path of the item.
+func (ctl *User) CreateBatch(c *gin.Context) {
+	var q request.CreateUsersBatch
+
+	if err := c.ShouldBind(&q); err != nil {
+		_ = c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	params := make([]user.CreateUserParams, len(q.Users))
+	for i, u := range q.Users {
+		params[i] = user.CreateUserParams{Username: u.Username, Email: u.Email}
+	}
 
-	created, err := ctl.UserService.CreateUser(c, &u)
+	results, err := ctl.UserService.CreateUsers(c.Request.Context(), params, user.BatchMode(q.Mode))
 	if err != nil {
 		_ = c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, response.Response[response.User]{Result: response.User(*created)})
+	resp := response.Response[[]*response.User]{Result: make([]*response.User, len(results))}
+
+	for i, res := range results {
+		if res.User != nil {
+			resp.Result[i] = (*response.User)(res.User)
+		}
+
+		path := fmt.Sprintf("CreateUsersBatch.Users[%d]", i)
+
+		if res.Err != nil {
+			if resp.Errors == nil {
+				resp.Errors = map[string][]response.Error{}
+			}
+
+			_, itemErr := response.FromBusinessError(res.Err)
+			resp.Errors[path] = append(resp.Errors[path], itemErr)
+		}
+
+		if res.Warning != nil {
+			if resp.Warnings == nil {
+				resp.Warnings = map[string][]response.Error{}
+			}
+
+			_, itemWarning := response.FromBusinessError(res.Warning)
+			resp.Warnings[path] = append(resp.Warnings[path], itemWarning)
+		}
+	}
+
+	c.JSON(http.StatusOK, resp)
 }
 
 func (ctl *User) Update(c *gin.Context) {
@@ -58,27 +123,109 @@ func (ctl *User) Update(c *gin.Context) {
 	)
 
 	if err := c.ShouldBindUri(&q); err != nil {
-		_ = c.Error(err)
+		_ = c.Error(err).SetType(gin.ErrorTypeBind)
 		return
 	}
 
 	if err := c.ShouldBind(&b); err != nil {
+		_ = c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	version, err := ifMatchVersion(c, ctl.currentVersion(c, q.ID))
+	if err != nil {
 		_ = c.Error(err)
 		return
 	}
 
 	u := user.UpdateUserParams{
 		ID:       q.ID,
-		Username: b.Username,
-		Email:    b.Email,
+		Username: &b.Username,
+		Email:    &b.Email,
+		Version:  version,
+	}
+
+	updated, err := ctl.UserService.UpdateUser(c.Request.Context(), &u)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	setETag(c, updated.Version)
+	c.JSON(http.StatusOK, response.Response[response.User]{Result: response.User(*updated)})
+}
+
+// currentVersion returns the version of a user, for ifMatchVersion.
+func (ctl *User) currentVersion(c *gin.Context, id int) func() (int, error) {
+	return func() (int, error) {
+		u, err := ctl.UserService.GetUserByID(c.Request.Context(), id)
+		if err != nil {
+			return 0, err
+		}
+
+		return u.Version, nil
+	}
+}
+
+// Patch applies a JSON Merge Patch (RFC 7396) to a user. Members that are absent from the patch are left unchanged.
+func (ctl *User) Patch(c *gin.Context) {
+	var (
+		q request.UpdateUserURI
+		b request.PatchUserBody
+	)
+
+	if err := c.ShouldBindUri(&q); err != nil {
+		_ = c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	if contentType := c.ContentType(); contentType != request.MergePatchContentType {
+		_ = c.Error(&response.Error{
+			Path:    "Content-Type",
+			Status:  http.StatusUnsupportedMediaType,
+			Code:    "UnsupportedMediaType",
+			Message: fmt.Sprintf("expected %s, got %q", request.MergePatchContentType, contentType),
+		})
+
+		return
+	}
+
+	if err := c.ShouldBindJSON(&b); err != nil {
+		_ = c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	if len(b.Nulls) > 0 {
+		for _, member := range b.Nulls {
+			_ = c.Error(&response.Error{
+				Path:    member,
+				Status:  http.StatusUnprocessableEntity,
+				Code:    "Required",
+				Message: fmt.Sprintf("%s cannot be removed", member),
+			})
+		}
+
+		return
+	}
+
+	version, err := ifMatchVersion(c, ctl.currentVersion(c, q.ID))
+	if err != nil {
+		_ = c.Error(err)
+		return
 	}
 
-	updated, err := ctl.UserService.UpdateUser(c, &u)
+	updated, err := ctl.UserService.UpdateUser(c.Request.Context(), &user.UpdateUserParams{
+		ID:       q.ID,
+		Username: b.Username,
+		Email:    b.Email,
+		Version:  version,
+	})
 	if err != nil {
 		_ = c.Error(err)
 		return
 	}
 
+	setETag(c, updated.Version)
 	c.JSON(http.StatusOK, response.Response[response.User]{Result: response.User(*updated)})
 }
 
@@ -88,11 +235,71 @@ func (ctl *User) Delete(c *gin.Context) {
 	}{}
 
 	if err := c.ShouldBindUri(&q); err != nil {
+		_ = c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	if err := ctl.UserService.DeleteUserByID(c.Request.Context(), q.ID); err != nil {
 		_ = c.Error(err)
 		return
 	}
 
-	if err := ctl.UserService.DeleteUserByID(c, q.ID); err != nil {
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+func (ctl *User) Restore(c *gin.Context) {
+	q := struct {
+		ID int `binding:"required" uri:"id"`
+	}{}
+
+	if err := c.ShouldBindUri(&q); err != nil {
+		_ = c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	restored, err := ctl.UserService.RestoreUserByID(c.Request.Context(), q.ID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	setETag(c, restored.Version)
+	c.JSON(http.StatusOK, response.Response[response.User]{Result: response.User(*restored)})
+}
+
+// RefreshDogPhoto replaces the dog photo of the user with a new random one. Like any other change, it increments the
+// version of the user.
+func (ctl *User) RefreshDogPhoto(c *gin.Context) {
+	q := struct {
+		ID int `binding:"required" uri:"id"`
+	}{}
+
+	if err := c.ShouldBindUri(&q); err != nil {
+		_ = c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	refreshed, err := ctl.UserService.RefreshDogPhoto(c.Request.Context(), q.ID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	setETag(c, refreshed.Version)
+	c.JSON(http.StatusOK, response.Response[response.User]{Result: response.User(*refreshed)})
+}
+
+func (ctl *User) Purge(c *gin.Context) {
+	q := struct {
+		ID int `binding:"required" uri:"id"`
+	}{}
+
+	if err := c.ShouldBindUri(&q); err != nil {
+		_ = c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	if err := ctl.UserService.PurgeUserByID(c.Request.Context(), q.ID); err != nil {
 		_ = c.Error(err)
 		return
 	}
@@ -104,22 +311,63 @@ func (ctl *User) GetFiltered(c *gin.Context) {
 	var q request.GetFilteredUsers
 
 	if err := c.ShouldBind(&q); err != nil {
-		_ = c.Error(err)
+		_ = c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	ctl.find(c, &q)
+}
+
+// List is GetFiltered with the filters in the query string, see request.ListUsers.
+func (ctl *User) List(c *gin.Context) {
+	var q request.ListUsers
+
+	if err := c.ShouldBindQuery(&q); err != nil {
+		_ = c.Error(err).SetType(gin.ErrorTypeBind)
 		return
 	}
 
-	f := user.FindAllFilter(q)
+	filter := q.GetFilteredUsers()
+	ctl.find(c, &filter)
+}
+
+func (ctl *User) find(c *gin.Context, q *request.GetFilteredUsers) {
+	f := toFindAllFilter(q)
 
-	filtered, err := ctl.UserService.FindAllUsersByFilter(c, &f)
+	filtered, err := ctl.UserService.FindAllUsersByFilter(c.Request.Context(), &f)
 	if err != nil {
 		_ = c.Error(err)
 		return
 	}
 
-	mapped := make([]response.User, len(filtered))
-	for i, u := range filtered {
+	mapped := make([]response.User, len(filtered.Users))
+	for i, u := range filtered.Users {
 		mapped[i] = response.User(u)
 	}
 
-	c.JSON(http.StatusOK, response.Response[[]response.User]{Result: mapped})
+	c.JSON(http.StatusOK, response.Response[[]response.User]{
+		Result: mapped,
+		Page:   &response.Page{Limit: filtered.Limit, NextCursor: filtered.NextCursor},
+	})
+}
+
+func toFindAllFilter(q *request.GetFilteredUsers) user.FindAllFilter {
+	sort := make([]user.SortKey, len(q.Sort))
+
+	for i, key := range q.Sort {
+		field, desc := strings.CutPrefix(key, "-")
+		sort[i] = user.SortKey{Field: user.SortField(field), Desc: desc}
+	}
+
+	return user.FindAllFilter{
+		IdsIn:          q.IdsIn,
+		Username:       q.Username,
+		UsernamePrefix: q.UsernamePrefix,
+		EmailDomain:    q.EmailDomain,
+		CreatedAt:      user.TimeRange(q.CreatedAt),
+		UpdatedAt:      user.TimeRange(q.UpdatedAt),
+		Sort:           sort,
+		Limit:          q.Limit,
+		After:          q.After,
+	}
 }
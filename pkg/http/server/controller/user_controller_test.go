@@ -2,19 +2,24 @@ package controller_test
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	application "github.com/PopescuStefanRadu/ent-demo/pkg/app"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/auth"
 	"github.com/PopescuStefanRadu/ent-demo/pkg/http/server"
 	"github.com/PopescuStefanRadu/ent-demo/pkg/http/server/request"
 	"github.com/PopescuStefanRadu/ent-demo/pkg/http/server/response"
 	"github.com/PopescuStefanRadu/ent-demo/pkg/user"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
 )
 
@@ -22,7 +27,7 @@ var SqlDB *sql.DB //nolint:golint,revive,stylecheck
 
 func TestMain(m *testing.M) {
 	var err error
-	SqlDB, err = sql.Open("sqlite3", "file:ent?mode=memory&cache=shared&_fk=1")
+	SqlDB, err = application.OpenTestDB()
 	if err != nil {
 		panic(err.Error())
 	}
@@ -37,7 +42,7 @@ func TestCreate(t *testing.T) {
 
 	mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org", nil).Times(1)
 
-	gin := server.NewRouter(app)
+	gin := server.NewRouter(app, server.RouterConfig{})
 
 	body, err := json.Marshal(request.CreateUser{
 		Username: "testUser",
@@ -69,6 +74,7 @@ func TestCreate(t *testing.T) {
 			DogPhotoURL: "https://example.org",
 			CreatedAt:   actualResp.Result.CreatedAt,
 			UpdatedAt:   actualResp.Result.UpdatedAt,
+			Version:     actualResp.Result.Version,
 		},
 		Errors: nil,
 	}, actualResp)
@@ -77,11 +83,11 @@ func TestCreate(t *testing.T) {
 func TestGet(t *testing.T) {
 	r, _, ctx, app, mocks := application.InitTest(t, SqlDB)
 
-	mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org", nil).Times(2)
+	mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org", nil).Times(1)
 
-	gin := server.NewRouter(app)
+	gin := server.NewRouter(app, server.RouterConfig{})
 
-	usr, err := app.CreateUser(ctx, &user.CreateUserParams{
+	usr, _, err := app.CreateUser(ctx, &user.CreateUserParams{
 		Username: "testUser",
 		Email:    "testUser@example.com",
 	})
@@ -98,6 +104,7 @@ func TestGet(t *testing.T) {
 	r.NoError(json.Unmarshal(w.Body.Bytes(), &actualResp))
 
 	r.Equal(http.StatusOK, w.Code)
+	r.Equal(`"1"`, w.Header().Get("ETag"))
 	r.Equal(response.Response[response.User]{
 		Result: response.User{
 			ID:          actualResp.Result.ID,
@@ -106,6 +113,7 @@ func TestGet(t *testing.T) {
 			DogPhotoURL: "https://example.org",
 			CreatedAt:   actualResp.Result.CreatedAt,
 			UpdatedAt:   actualResp.Result.UpdatedAt,
+			Version:     actualResp.Result.Version,
 		},
 	}, actualResp)
 }
@@ -113,11 +121,11 @@ func TestGet(t *testing.T) {
 func TestUpdate(t *testing.T) {
 	r, _, ctx, app, mocks := application.InitTest(t, SqlDB)
 
-	mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org", nil).Times(2)
+	mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org", nil).Times(1)
 
-	gin := server.NewRouter(app)
+	gin := server.NewRouter(app, server.RouterConfig{})
 
-	usr, err := app.CreateUser(ctx, &user.CreateUserParams{
+	usr, _, err := app.CreateUser(ctx, &user.CreateUserParams{
 		Username: "testUser",
 		Email:    "testUser@example.com",
 	})
@@ -132,6 +140,7 @@ func TestUpdate(t *testing.T) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodPut, fmt.Sprintf("/user/%d", usr.ID), bytes.NewReader(body))
 	r.NoError(err)
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", `"1"`)
 	w := httptest.NewRecorder()
 
 	gin.ServeHTTP(w, req)
@@ -140,6 +149,8 @@ func TestUpdate(t *testing.T) {
 	r.NoError(json.Unmarshal(w.Body.Bytes(), &actualResp))
 
 	r.Equal(http.StatusOK, w.Code)
+	r.Equal(`"2"`, w.Header().Get("ETag"))
+	r.Equal(2, actualResp.Result.Version)
 	r.Equal(response.Response[response.User]{
 		Result: response.User{
 			ID:          actualResp.Result.ID,
@@ -148,6 +159,7 @@ func TestUpdate(t *testing.T) {
 			DogPhotoURL: "https://example.org",
 			CreatedAt:   actualResp.Result.CreatedAt,
 			UpdatedAt:   actualResp.Result.UpdatedAt,
+			Version:     actualResp.Result.Version,
 		},
 	}, actualResp)
 }
@@ -157,9 +169,9 @@ func TestDelete(t *testing.T) {
 
 	mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org", nil).Times(1)
 
-	gin := server.NewRouter(app)
+	gin := server.NewRouter(app, server.RouterConfig{})
 
-	usr, err := app.CreateUser(ctx, &user.CreateUserParams{
+	usr, _, err := app.CreateUser(ctx, &user.CreateUserParams{
 		Username: "testUser",
 		Email:    "testUser@example.com",
 	})
@@ -175,29 +187,29 @@ func TestDelete(t *testing.T) {
 
 	remainingUsers, err := app.FindAllUsersByFilter(ctx, nil)
 	r.NoError(err)
-	r.Equal(0, len(remainingUsers))
+	r.Equal(0, len(remainingUsers.Users))
 }
 
 func TestGetFiltered(t *testing.T) {
 	r, _, ctx, app, mocks := application.InitTest(t, SqlDB)
 
-	mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org", nil).Times(5)
+	mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org", nil).Times(3)
 
-	gin := server.NewRouter(app)
+	gin := server.NewRouter(app, server.RouterConfig{})
 
-	usr1, err := app.CreateUser(ctx, &user.CreateUserParams{
+	usr1, _, err := app.CreateUser(ctx, &user.CreateUserParams{
 		Username: "testUser1",
 		Email:    "testUser1@example.com",
 	})
 	r.NoError(err)
 
-	usr2, err := app.CreateUser(ctx, &user.CreateUserParams{
+	usr2, _, err := app.CreateUser(ctx, &user.CreateUserParams{
 		Username: "testUser2",
 		Email:    "testUser2@example.com",
 	})
 	r.NoError(err)
 
-	_, err = app.CreateUser(ctx, &user.CreateUserParams{
+	_, _, err = app.CreateUser(ctx, &user.CreateUserParams{
 		Username: "testUser3",
 		Email:    "testUser3@example.com",
 	})
@@ -221,5 +233,767 @@ func TestGetFiltered(t *testing.T) {
 	r.Equal(http.StatusOK, w.Code)
 	r.Equal(response.Response[[]response.User]{
 		Result: []response.User{response.User(*usr1), response.User(*usr2)},
+		Page:   &response.Page{Limit: user.DefaultPageLimit},
 	}, actualResp)
 }
+
+func TestGetFilteredPaginated(t *testing.T) {
+	r, _, ctx, app, mocks := application.InitTest(t, SqlDB)
+
+	mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org", nil).Times(3)
+
+	gin := server.NewRouter(app, server.RouterConfig{})
+
+	created := make([]response.User, 3)
+
+	for i := range created {
+		usr, _, err := app.CreateUser(ctx, &user.CreateUserParams{
+			Username: fmt.Sprintf("testUser%d", i),
+			Email:    fmt.Sprintf("testUser%d@example.com", i),
+		})
+		r.NoError(err)
+
+		created[i] = response.User(*usr)
+	}
+
+	search := func(filter request.GetFilteredUsers) response.Response[[]response.User] {
+		body, err := json.Marshal(filter)
+		r.NoError(err)
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/search-users", bytes.NewReader(body))
+		r.NoError(err)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+
+		gin.ServeHTTP(w, req)
+
+		r.Equal(http.StatusOK, w.Code, w.Body.String())
+
+		var actualResp response.Response[[]response.User]
+		r.NoError(json.Unmarshal(w.Body.Bytes(), &actualResp), w.Body.String())
+
+		return actualResp
+	}
+
+	firstPage := search(request.GetFilteredUsers{Limit: 2})
+	r.Equal(created[0:2], firstPage.Result)
+	r.Equal(2, firstPage.Page.Limit)
+	r.NotEmpty(firstPage.Page.NextCursor)
+
+	secondPage := search(request.GetFilteredUsers{Limit: 2, After: firstPage.Page.NextCursor})
+	r.Equal(created[2:], secondPage.Result)
+	r.Equal(&response.Page{Limit: 2}, secondPage.Page)
+
+	sorted := search(request.GetFilteredUsers{
+		UsernamePrefix: "testUser",
+		EmailDomain:    "example.com",
+		Sort:           []string{"-username"},
+	})
+	r.Equal([]response.User{created[2], created[1], created[0]}, sorted.Result)
+}
+
+func TestErrorStatuses(t *testing.T) {
+	tests := []struct {
+		name           string
+		setup          func(r *require.Assertions, ctx context.Context, app *application.App, mocks application.Mocks) *http.Request
+		expectedStatus int
+		expectedPath   string
+		expectedCode   string
+	}{
+		{
+			name: "malformed body",
+			setup: func(r *require.Assertions, ctx context.Context, _ *application.App, _ application.Mocks) *http.Request {
+				req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/user", strings.NewReader("{"))
+				r.NoError(err)
+				req.Header.Set("Content-Type", "application/json")
+
+				return req
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   "BadRequest",
+		},
+		{
+			name: "malformed cursor",
+			setup: func(r *require.Assertions, ctx context.Context, _ *application.App, _ application.Mocks) *http.Request {
+				body, err := json.Marshal(request.GetFilteredUsers{After: "not a cursor"})
+				r.NoError(err)
+
+				req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/search-users", bytes.NewReader(body))
+				r.NoError(err)
+				req.Header.Set("Content-Type", "application/json")
+
+				return req
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedCode:   "InvalidInput",
+		},
+		{
+			name: "unknown sort field",
+			setup: func(r *require.Assertions, ctx context.Context, _ *application.App, _ application.Mocks) *http.Request {
+				body, err := json.Marshal(request.GetFilteredUsers{Sort: []string{"password"}})
+				r.NoError(err)
+
+				req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/search-users", bytes.NewReader(body))
+				r.NoError(err)
+				req.Header.Set("Content-Type", "application/json")
+
+				return req
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedPath:   "GetFilteredUsers.Sort[0]",
+			expectedCode:   "oneof",
+		},
+		{
+			name: "update without If-Match",
+			setup: func(r *require.Assertions, ctx context.Context, app *application.App, mocks application.Mocks) *http.Request {
+				return updateRequest(r, ctx, app, mocks, "")
+			},
+			expectedStatus: http.StatusPreconditionRequired,
+			expectedPath:   "If-Match",
+			expectedCode:   "PreconditionRequired",
+		},
+		{
+			name: "update with stale If-Match",
+			setup: func(r *require.Assertions, ctx context.Context, app *application.App, mocks application.Mocks) *http.Request {
+				return updateRequest(r, ctx, app, mocks, `"2"`)
+			},
+			expectedStatus: http.StatusPreconditionFailed,
+			expectedCode:   "VersionMismatch",
+		},
+		{
+			name: "update with stale If-Match list",
+			setup: func(r *require.Assertions, ctx context.Context, app *application.App, mocks application.Mocks) *http.Request {
+				return updateRequest(r, ctx, app, mocks, `"2", W/"1", "3"`)
+			},
+			expectedStatus: http.StatusPreconditionFailed,
+			expectedCode:   "VersionMismatch",
+		},
+		{
+			name: "missing user",
+			setup: func(r *require.Assertions, ctx context.Context, _ *application.App, _ application.Mocks) *http.Request {
+				req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/user/4242", nil)
+				r.NoError(err)
+
+				return req
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedCode:   "NotFound",
+		},
+		{
+			name: "duplicate email",
+			setup: func(r *require.Assertions, ctx context.Context, app *application.App, mocks application.Mocks) *http.Request {
+				mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org", nil).Times(2)
+
+				_, _, err := app.CreateUser(ctx, &user.CreateUserParams{Username: "testUser", Email: "testUser@example.com"})
+				r.NoError(err)
+
+				body, err := json.Marshal(request.CreateUser{Username: "otherUser", Email: "testUser@example.com"})
+				r.NoError(err)
+
+				req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/user", bytes.NewReader(body))
+				r.NoError(err)
+				req.Header.Set("Content-Type", "application/json")
+
+				return req
+			},
+			expectedStatus: http.StatusConflict,
+			expectedCode:   "Conflict",
+		},
+		{
+			name: "dog API unavailable",
+			setup: func(r *require.Assertions, ctx context.Context, app *application.App, mocks application.Mocks) *http.Request {
+				mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org", nil).Times(1)
+				mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("", user.ErrDependencyUnavailable).Times(1)
+
+				usr, _, err := app.CreateUser(ctx, &user.CreateUserParams{Username: "testUser", Email: "testUser@example.com"})
+				r.NoError(err)
+
+				req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+					fmt.Sprintf("/user/%d/dog-photo/refresh", usr.ID), nil)
+				r.NoError(err)
+
+				return req
+			},
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedCode:   "DependencyUnavailable",
+		},
+		{
+			name: "dog API failure",
+			setup: func(r *require.Assertions, ctx context.Context, app *application.App, mocks application.Mocks) *http.Request {
+				mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org", nil).Times(1)
+				mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("", user.ErrDependencyFailure).Times(1)
+
+				usr, _, err := app.CreateUser(ctx, &user.CreateUserParams{Username: "testUser", Email: "testUser@example.com"})
+				r.NoError(err)
+
+				req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+					fmt.Sprintf("/user/%d/dog-photo/refresh", usr.ID), nil)
+				r.NoError(err)
+
+				return req
+			},
+			expectedStatus: http.StatusBadGateway,
+			expectedCode:   "DependencyFailure",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _, ctx, app, mocks := application.InitTest(t, SqlDB)
+
+			gin := server.NewRouter(app, server.RouterConfig{})
+
+			w := httptest.NewRecorder()
+			gin.ServeHTTP(w, tt.setup(r, ctx, app, mocks))
+
+			var actualResp response.Response[*any]
+			r.NoError(json.Unmarshal(w.Body.Bytes(), &actualResp), w.Body.String())
+
+			path := tt.expectedPath
+			if path == "" {
+				path = "global"
+			}
+
+			r.Equal(tt.expectedStatus, w.Code, w.Body.String())
+			r.Len(actualResp.Errors[path], 1, w.Body.String())
+			r.Equal(tt.expectedCode, actualResp.Errors[path][0].Code)
+		})
+	}
+}
+
+func updateRequest(
+	r *require.Assertions,
+	ctx context.Context,
+	app *application.App,
+	mocks application.Mocks,
+	ifMatch string,
+) *http.Request {
+	mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org", nil).Times(1)
+
+	usr, _, err := app.CreateUser(ctx, &user.CreateUserParams{Username: "testUser", Email: "testUser@example.com"})
+	r.NoError(err)
+
+	body, err := json.Marshal(request.UpdateUserBody{Username: "updatedTestUser", Email: "updatedTestUser@example.com"})
+	r.NoError(err)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, fmt.Sprintf("/user/%d", usr.ID), bytes.NewReader(body))
+	r.NoError(err)
+	req.Header.Set("Content-Type", "application/json")
+
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+
+	return req
+}
+
+func TestRestoreAndPurge(t *testing.T) {
+	r, _, ctx, app, mocks := application.InitTest(t, SqlDB)
+
+	mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org", nil).Times(1)
+
+	gin := server.NewRouter(app, server.RouterConfig{AdminToken: "secret"})
+
+	usr, _, err := app.CreateUser(ctx, &user.CreateUserParams{
+		Username: "testUser",
+		Email:    "testUser@example.com",
+	})
+	r.NoError(err)
+	r.NoError(app.DeleteUserByID(ctx, usr.ID))
+
+	serve := func(method, path string, headers map[string]string) *httptest.ResponseRecorder {
+		req, err := http.NewRequestWithContext(ctx, method, path, nil)
+		r.NoError(err)
+
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+
+		w := httptest.NewRecorder()
+		gin.ServeHTTP(w, req)
+
+		return w
+	}
+
+	w := serve(http.MethodPost, fmt.Sprintf("/user/%d/restore", usr.ID), nil)
+	r.Equal(http.StatusOK, w.Code, w.Body.String())
+
+	var actualResp response.Response[response.User]
+	r.NoError(json.Unmarshal(w.Body.Bytes(), &actualResp))
+	r.Equal(usr.ID, actualResp.Result.ID)
+
+	w = serve(http.MethodDelete, fmt.Sprintf("/admin/user/%d", usr.ID), nil)
+	r.Equal(http.StatusForbidden, w.Code, w.Body.String())
+
+	w = serve(http.MethodDelete, fmt.Sprintf("/admin/user/%d", usr.ID), map[string]string{"X-Admin-Token": "wrong"})
+	r.Equal(http.StatusForbidden, w.Code, w.Body.String())
+
+	w = serve(http.MethodDelete, fmt.Sprintf("/admin/user/%d", usr.ID), map[string]string{"X-Admin-Token": "secret"})
+	r.Equal(http.StatusOK, w.Code, w.Body.String())
+
+	w = serve(http.MethodPost, fmt.Sprintf("/user/%d/restore", usr.ID), nil)
+	r.Equal(http.StatusNotFound, w.Code, w.Body.String())
+}
+
+func TestRefreshDogPhoto(t *testing.T) {
+	r, _, ctx, app, mocks := application.InitTest(t, SqlDB)
+
+	gomock.InOrder(
+		mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org/1.jpg", nil),
+		mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org/2.jpg", nil),
+	)
+
+	gin := server.NewRouter(app, server.RouterConfig{})
+
+	usr, _, err := app.CreateUser(ctx, &user.CreateUserParams{
+		Username: "testUser",
+		Email:    "testUser@example.com",
+	})
+	r.NoError(err)
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		req, err := http.NewRequestWithContext(ctx, method, path, nil)
+		r.NoError(err)
+
+		w := httptest.NewRecorder()
+		gin.ServeHTTP(w, req)
+
+		return w
+	}
+
+	w := serve(http.MethodPost, fmt.Sprintf("/user/%d/dog-photo/refresh", usr.ID))
+	r.Equal(http.StatusOK, w.Code, w.Body.String())
+	r.Equal(`"2"`, w.Header().Get("ETag"))
+
+	var refreshResp response.Response[response.User]
+	r.NoError(json.Unmarshal(w.Body.Bytes(), &refreshResp), w.Body.String())
+	r.Equal("https://example.org/2.jpg", refreshResp.Result.DogPhotoURL)
+
+	w = serve(http.MethodGet, fmt.Sprintf("/user/%d", usr.ID))
+	r.Equal(http.StatusOK, w.Code, w.Body.String())
+
+	var getResp response.Response[response.User]
+	r.NoError(json.Unmarshal(w.Body.Bytes(), &getResp), w.Body.String())
+	r.Equal(refreshResp, getResp)
+}
+
+func TestPatch(t *testing.T) {
+	r, _, ctx, app, mocks := application.InitTest(t, SqlDB)
+
+	mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org", nil).Times(1)
+
+	gin := server.NewRouter(app, server.RouterConfig{})
+
+	usr, _, err := app.CreateUser(ctx, &user.CreateUserParams{
+		Username: "testUser",
+		Email:    "testUser@example.com",
+	})
+	r.NoError(err)
+
+	patch := func(contentType, ifMatch, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPatch, fmt.Sprintf("/user/%d", usr.ID), strings.NewReader(body))
+		r.NoError(err)
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("If-Match", ifMatch)
+
+		w := httptest.NewRecorder()
+		gin.ServeHTTP(w, req)
+
+		return w
+	}
+
+	w := patch("application/json", `"1"`, `{"email": "patchedTestUser@example.com"}`)
+	r.Equal(http.StatusUnsupportedMediaType, w.Code, w.Body.String())
+
+	w = patch(request.MergePatchContentType, `"1"`, `{"email": null}`)
+	r.Equal(http.StatusUnprocessableEntity, w.Code, w.Body.String())
+
+	var errResp response.Response[*any]
+	r.NoError(json.Unmarshal(w.Body.Bytes(), &errResp), w.Body.String())
+	r.Equal("Required", errResp.Errors["email"][0].Code)
+
+	// members match the fields case-insensitively, as for the other JSON bodies
+	w = patch(request.MergePatchContentType, `"1"`, `{"Email": null}`)
+	r.Equal(http.StatusUnprocessableEntity, w.Code, w.Body.String())
+
+	errResp = response.Response[*any]{}
+	r.NoError(json.Unmarshal(w.Body.Bytes(), &errResp), w.Body.String())
+	r.Equal("Required", errResp.Errors["email"][0].Code)
+
+	w = patch(request.MergePatchContentType, `"1"`, `{"email": "patchedTestUser@example.com", "unknown": null}`)
+	r.Equal(http.StatusOK, w.Code, w.Body.String())
+	r.Equal(`"2"`, w.Header().Get("ETag"))
+
+	var actualResp response.Response[response.User]
+	r.NoError(json.Unmarshal(w.Body.Bytes(), &actualResp), w.Body.String())
+	r.Equal("testUser", actualResp.Result.Username)
+	r.Equal("patchedTestUser@example.com", actualResp.Result.Email)
+
+	patched := actualResp.Result
+
+	// an empty patch changes nothing, but still checks the version
+	w = patch(request.MergePatchContentType, `"2"`, `{}`)
+	r.Equal(http.StatusOK, w.Code, w.Body.String())
+	r.Equal(`"2"`, w.Header().Get("ETag"))
+
+	actualResp = response.Response[response.User]{}
+	r.NoError(json.Unmarshal(w.Body.Bytes(), &actualResp), w.Body.String())
+	r.Equal(patched, actualResp.Result)
+
+	w = patch(request.MergePatchContentType, `"1"`, `{}`)
+	r.Equal(http.StatusPreconditionFailed, w.Code, w.Body.String())
+
+	// any of the listed entity tags matches
+	w = patch(request.MergePatchContentType, `"1", "2", "3"`, `{"username": "listedTestUser"}`)
+	r.Equal(http.StatusOK, w.Code, w.Body.String())
+	r.Equal(`"3"`, w.Header().Get("ETag"))
+}
+
+func TestCreateBatch(t *testing.T) {
+	r, _, ctx, app, mocks := application.InitTest(t, SqlDB)
+
+	mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org", nil).Times(4)
+
+	gin := server.NewRouter(app, server.RouterConfig{})
+
+	createBatch := func(path string, batch request.CreateUsersBatch) *httptest.ResponseRecorder {
+		body, err := json.Marshal(batch)
+		r.NoError(err)
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, path, bytes.NewReader(body))
+		r.NoError(err)
+		req.Header.Set("Content-Type", "application/json")
+
+		w := httptest.NewRecorder()
+		gin.ServeHTTP(w, req)
+
+		return w
+	}
+
+	w := createBatch("/users:batch", request.CreateUsersBatch{
+		Mode: string(user.BatchAllOrNothing),
+		Users: []request.CreateUser{
+			{Username: "testUser1", Email: "testUser1@example.com"},
+			{Username: "testUser2", Email: "testUser2@example.com"},
+		},
+	})
+	r.Equal(http.StatusOK, w.Code, w.Body.String())
+
+	var allOrNothingResp response.Response[[]*response.User]
+	r.NoError(json.Unmarshal(w.Body.Bytes(), &allOrNothingResp))
+	r.Len(allOrNothingResp.Result, 2)
+	r.Equal("testUser2", allOrNothingResp.Result[1].Username)
+
+	w = createBatch("/users:batch", request.CreateUsersBatch{
+		Mode: string(user.BatchBestEffort),
+		Users: []request.CreateUser{
+			{Username: "testUser3", Email: "testUser1@example.com"},
+			{Username: "testUser4", Email: "testUser4@example.com"},
+		},
+	})
+	r.Equal(http.StatusOK, w.Code, w.Body.String())
+
+	var bestEffortResp response.Response[[]*response.User]
+	r.NoError(json.Unmarshal(w.Body.Bytes(), &bestEffortResp))
+	r.Len(bestEffortResp.Result, 2)
+	r.Nil(bestEffortResp.Result[0])
+	r.Equal("testUser4", bestEffortResp.Result[1].Username)
+	r.Equal("Conflict", bestEffortResp.Errors["CreateUsersBatch.Users[0]"][0].Code)
+	r.Len(bestEffortResp.Errors, 1)
+
+	w = createBatch("/users:unknown", request.CreateUsersBatch{})
+	r.Equal(http.StatusNotFound, w.Code, w.Body.String())
+}
+
+func TestCreateDegradedEnrichment(t *testing.T) {
+	r, _, ctx, app, mocks := application.InitTest(t, SqlDB)
+
+	app.Enrichment = user.EnrichmentConfig{Mode: user.EnrichDegrade}
+	mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("", user.ErrDependencyUnavailable).Times(1)
+
+	gin := server.NewRouter(app, server.RouterConfig{})
+
+	body, err := json.Marshal(request.CreateUser{Username: "testUser", Email: "testUser@example.com"})
+	r.NoError(err)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/user", bytes.NewReader(body))
+	r.NoError(err)
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	gin.ServeHTTP(w, req)
+	r.Equal(http.StatusOK, w.Code, w.Body.String())
+
+	var actualResp response.Response[response.User]
+	r.NoError(json.Unmarshal(w.Body.Bytes(), &actualResp), w.Body.String())
+	r.Equal("testUser", actualResp.Result.Username)
+	r.Empty(actualResp.Result.DogPhotoURL)
+	r.Equal("DependencyUnavailable", actualResp.Warnings["global"][0].Code)
+}
+
+func TestCreateBatchDegradedEnrichment(t *testing.T) {
+	r, _, ctx, app, mocks := application.InitTest(t, SqlDB)
+
+	app.Enrichment = user.EnrichmentConfig{Mode: user.EnrichDegrade}
+
+	mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("", user.ErrDependencyUnavailable).Times(2)
+
+	gin := server.NewRouter(app, server.RouterConfig{})
+
+	body, err := json.Marshal(request.CreateUsersBatch{
+		Mode: string(user.BatchBestEffort),
+		Users: []request.CreateUser{
+			{Username: "testUser1", Email: "testUser1@example.com"},
+			{Username: "testUser2", Email: "testUser2@example.com"},
+		},
+	})
+	r.NoError(err)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/users:batch", bytes.NewReader(body))
+	r.NoError(err)
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	gin.ServeHTTP(w, req)
+	r.Equal(http.StatusOK, w.Code, w.Body.String())
+
+	var actualResp response.Response[[]*response.User]
+	r.NoError(json.Unmarshal(w.Body.Bytes(), &actualResp), w.Body.String())
+	r.Len(actualResp.Result, 2)
+	r.Empty(actualResp.Errors)
+	r.Len(actualResp.Warnings, 2)
+
+	for i, u := range actualResp.Result {
+		r.Empty(u.DogPhotoURL)
+		r.Equal("DependencyUnavailable", actualResp.Warnings[fmt.Sprintf("CreateUsersBatch.Users[%d]", i)][0].Code)
+	}
+}
+
+func TestCreateBatchTooLarge(t *testing.T) {
+	r, _, ctx, app, _ := application.InitTest(t, SqlDB)
+
+	gin := server.NewRouter(app, server.RouterConfig{})
+
+	batch := request.CreateUsersBatch{Mode: string(user.BatchAllOrNothing)}
+	for i := 0; i <= user.MaxBatchSize; i++ {
+		batch.Users = append(batch.Users, request.CreateUser{
+			Username: fmt.Sprintf("testUser%d", i),
+			Email:    fmt.Sprintf("testUser%d@example.com", i),
+		})
+	}
+
+	body, err := json.Marshal(batch)
+	r.NoError(err)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/v1/users:batch", bytes.NewReader(body))
+	r.NoError(err)
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	gin.ServeHTTP(w, req)
+	r.Equal(http.StatusUnprocessableEntity, w.Code, w.Body.String())
+
+	var errResp response.Response[*any]
+	r.NoError(json.Unmarshal(w.Body.Bytes(), &errResp), w.Body.String())
+	r.Equal("InvalidInput", errResp.Errors["global"][0].Code)
+}
+
+func TestList(t *testing.T) {
+	r, _, ctx, app, mocks := application.InitTest(t, SqlDB)
+
+	mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org", nil).Times(3)
+
+	gin := server.NewRouter(app, server.RouterConfig{})
+
+	created := make([]response.User, 3)
+
+	for i := range created {
+		usr, _, err := app.CreateUser(ctx, &user.CreateUserParams{
+			Username: fmt.Sprintf("testUser%d", i),
+			Email:    fmt.Sprintf("testUser%d@example.com", i),
+		})
+		r.NoError(err)
+
+		created[i] = response.User(*usr)
+	}
+
+	list := func(query string) (*httptest.ResponseRecorder, response.Response[[]response.User]) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/v1/users?"+query, nil)
+		r.NoError(err)
+
+		w := httptest.NewRecorder()
+		gin.ServeHTTP(w, req)
+
+		var actualResp response.Response[[]response.User]
+		r.NoError(json.Unmarshal(w.Body.Bytes(), &actualResp), w.Body.String())
+
+		return w, actualResp
+	}
+
+	w, page := list(fmt.Sprintf("ids_in=%d&ids_in=%d&sort=-username", created[0].ID, created[2].ID))
+	r.Equal(http.StatusOK, w.Code, w.Body.String())
+	r.Empty(w.Header().Get("Deprecation"))
+	r.Equal([]response.User{created[2], created[0]}, page.Result)
+
+	w, page = list("username_prefix=testUser&limit=2")
+	r.Equal(http.StatusOK, w.Code, w.Body.String())
+	r.Equal(created[0:2], page.Result)
+	r.NotEmpty(page.Page.NextCursor)
+
+	w, page = list("limit=2&after=" + page.Page.NextCursor)
+	r.Equal(http.StatusOK, w.Code, w.Body.String())
+	r.Equal(created[2:], page.Result)
+
+	w, page = list("created_from=" + time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+	r.Equal(http.StatusOK, w.Code, w.Body.String())
+	r.Empty(page.Result)
+
+	w, _ = list("sort=password")
+	r.Equal(http.StatusBadRequest, w.Code, w.Body.String())
+
+	w, _ = list("created_from=yesterday")
+	r.Equal(http.StatusBadRequest, w.Code, w.Body.String())
+}
+
+func TestLegacyRoutesAreDeprecated(t *testing.T) {
+	r, _, ctx, app, mocks := application.InitTest(t, SqlDB)
+
+	mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).Return("https://example.org", nil).Times(3)
+
+	sunset := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	gin := server.NewRouter(app, server.RouterConfig{LegacySunset: sunset})
+
+	usr, _, err := app.CreateUser(ctx, &user.CreateUserParams{
+		Username: "testUser",
+		Email:    "testUser@example.com",
+	})
+	r.NoError(err)
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequestWithContext(ctx, method, path, strings.NewReader(body))
+		r.NoError(err)
+		req.Header.Set("Content-Type", "application/json")
+
+		w := httptest.NewRecorder()
+		gin.ServeHTTP(w, req)
+
+		return w
+	}
+
+	batch := `{"mode": "best_effort", "users": [{"username": "testUser%d", "email": "testUser%d@example.com"}]}`
+
+	tests := []struct {
+		name      string
+		method    string
+		legacy    string
+		successor string
+		body      string
+	}{
+		{name: "get", method: http.MethodGet, legacy: fmt.Sprintf("/user/%d", usr.ID),
+			successor: fmt.Sprintf("/v1/users/%d", usr.ID)},
+		{name: "custom method", method: http.MethodPost, legacy: "/users:batch", successor: "/v1/users:batch",
+			body: fmt.Sprintf(batch, 1, 1)},
+		{name: "search", method: http.MethodPost, legacy: "/search-users", successor: "/v1/users", body: "{}"},
+	}
+
+	for _, tt := range tests {
+		ttCpy := tt
+
+		t.Run(ttCpy.name, func(t *testing.T) {
+			r := require.New(t)
+
+			w := serve(ttCpy.method, ttCpy.legacy, ttCpy.body)
+			r.Equal(http.StatusOK, w.Code, w.Body.String())
+			r.Equal(fmt.Sprintf("@%d", server.LegacyDeprecation.Unix()), w.Header().Get("Deprecation"))
+			r.Equal("Tue, 01 Jan 2030 00:00:00 GMT", w.Header().Get("Sunset"))
+			r.Equal(fmt.Sprintf(`<%s>; rel="successor-version"`, ttCpy.successor), w.Header().Get("Link"))
+		})
+	}
+
+	w := serve(http.MethodGet, fmt.Sprintf("/v1/users/%d", usr.ID), "")
+	r.Equal(http.StatusOK, w.Code, w.Body.String())
+	r.Empty(w.Header().Get("Deprecation"))
+	r.Empty(w.Header().Get("Sunset"))
+
+	w = serve(http.MethodPost, "/v1/users:batch", fmt.Sprintf(batch, 2, 2))
+	r.Equal(http.StatusOK, w.Code, w.Body.String())
+	r.Empty(w.Header().Get("Deprecation"))
+}
+
+//nolint:funlen
+func TestAuthentication(t *testing.T) {
+	r, _, ctx, app, mocks := application.InitTest(t, SqlDB)
+
+	verifier, err := auth.NewVerifier(auth.Config{HS256Secret: "secret", Issuer: "issuer", Audience: "ent-demo"})
+	r.NoError(err)
+
+	// the service sees the identity of the caller
+	mocks.DogClient.EXPECT().GetRandomDogURL(gomock.Any()).DoAndReturn(func(ctx context.Context) (string, error) {
+		claims, ok := auth.FromContext(ctx)
+		r.True(ok)
+		r.Equal("alice", claims.Subject)
+
+		return "https://example.org", nil
+	}).Times(1)
+
+	gin := server.NewRouter(app, server.RouterConfig{Verifier: verifier})
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "alice",
+		"iss": "issuer",
+		"aud": "ent-demo",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte("secret"))
+	r.NoError(err)
+
+	serve := func(method, path, authorization, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequestWithContext(ctx, method, path, strings.NewReader(body))
+		r.NoError(err)
+		req.Header.Set("Content-Type", "application/json")
+
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+
+		w := httptest.NewRecorder()
+		gin.ServeHTTP(w, req)
+
+		return w
+	}
+
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		authorization string
+		status        int
+		challenge     string
+	}{
+		{name: "public", method: http.MethodGet, path: "/health", status: http.StatusOK},
+		{name: "missing token", method: http.MethodGet, path: "/v1/users/1", status: http.StatusUnauthorized,
+			challenge: "Bearer"},
+		{name: "other scheme", method: http.MethodGet, path: "/v1/users/1", authorization: "Basic YWxpY2U6c2VjcmV0",
+			status: http.StatusUnauthorized, challenge: "Bearer"},
+		{name: "invalid token", method: http.MethodGet, path: "/v1/users/1", authorization: "Bearer " + token + "x",
+			status: http.StatusUnauthorized, challenge: `Bearer error="invalid_token"`},
+		{name: "legacy route", method: http.MethodDelete, path: "/user/1", status: http.StatusUnauthorized,
+			challenge: "Bearer"},
+		{name: "valid token", method: http.MethodGet, path: "/v1/users/999999", authorization: "bearer " + token,
+			status: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		ttCpy := tt
+
+		t.Run(ttCpy.name, func(t *testing.T) {
+			r := require.New(t)
+
+			w := serve(ttCpy.method, ttCpy.path, ttCpy.authorization, "")
+			r.Equal(ttCpy.status, w.Code, w.Body.String())
+			r.Equal(ttCpy.challenge, w.Header().Get("WWW-Authenticate"))
+		})
+	}
+
+	w := serve(http.MethodPost, "/v1/users", "Bearer "+token, `{"username": "alice", "email": "alice@example.com"}`)
+	r.Equal(http.StatusOK, w.Code, w.Body.String())
+}
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/PopescuStefanRadu/ent-demo/pkg/http/server/response"
+	"github.com/gin-gonic/gin"
+)
+
+const AdminTokenHeader = "X-Admin-Token"
+
+// AdminOnly lets through only the requests that carry Token in the AdminTokenHeader header.
+type AdminOnly struct {
+	Token string
+}
+
+func (a *AdminOnly) Authorize(c *gin.Context) {
+	token := c.GetHeader(AdminTokenHeader)
+
+	if a.Token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(a.Token)) != 1 {
+		c.AbortWithStatusJSON(http.StatusForbidden, response.Response[*any]{
+			Errors: map[string][]response.Error{"global": {{
+				Code:    "Forbidden",
+				Message: "admin privileges required",
+			}}},
+		})
+
+		return
+	}
+
+	c.Next()
+}
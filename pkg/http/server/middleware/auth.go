@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/PopescuStefanRadu/ent-demo/pkg/auth"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/http/server/response"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Authenticate lets through only the requests that carry a valid JWT as a bearer token (RFC 6750). The claims of the
+// token are stored in the context of the request, see auth.FromContext, and the subject is added to its logger and
+// span.
+type Authenticate struct {
+	Verifier *auth.Verifier
+}
+
+func (a *Authenticate) Handle(c *gin.Context) {
+	scheme, token, _ := strings.Cut(c.GetHeader("Authorization"), " ")
+	if !strings.EqualFold(scheme, "Bearer") || token == "" {
+		unauthorized(c, `Bearer`, "a bearer token is required")
+		return
+	}
+
+	claims, err := a.Verifier.Verify(strings.TrimSpace(token))
+	if err != nil {
+		zerolog.Ctx(c.Request.Context()).Debug().Err(err).Msg("Rejected the bearer token")
+		unauthorized(c, `Bearer error="invalid_token"`, "the bearer token is invalid")
+
+		return
+	}
+
+	ctx := auth.NewContext(c.Request.Context(), claims)
+	ctx = zerolog.Ctx(ctx).With().Str("subject", claims.Subject).Logger().WithContext(ctx)
+	trace.SpanFromContext(ctx).SetAttributes(semconv.EnduserID(claims.Subject))
+	c.Request = c.Request.WithContext(ctx)
+
+	c.Next()
+}
+
+func unauthorized(c *gin.Context, challenge, message string) {
+	c.Header("WWW-Authenticate", challenge)
+	c.AbortWithStatusJSON(http.StatusUnauthorized, response.Response[*any]{
+		Errors: map[string][]response.Error{"global": {{
+			Code:    "Unauthorized",
+			Message: message,
+		}}},
+	})
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+//nolint:gochecknoglobals
+var routeParam = regexp.MustCompile(`:[A-Za-z_]+`)
+
+// Deprecated announces that a route is deprecated since Since, with the Deprecation header (RFC 9745), and that it
+// stops working at Sunset, with the Sunset header (RFC 8594). The Sunset header is omitted when Sunset is zero.
+type Deprecated struct {
+	Since  time.Time
+	Sunset time.Time
+}
+
+// Successor returns the middleware of a deprecated route that is replaced by the route path, e.g. /v1/users/:id. The
+// successor is linked in the Link header, with the parameters of the request filled in, e.g. </v1/users/42>.
+func (d *Deprecated) Successor(path string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		successor := routeParam.ReplaceAllStringFunc(path, func(param string) string {
+			return c.Param(param[1:])
+		})
+
+		h := c.Writer.Header()
+		h.Set("Deprecation", fmt.Sprintf("@%d", d.Since.Unix()))
+
+		if !d.Sunset.IsZero() {
+			h.Set("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+		}
+
+		h.Set("Link", fmt.Sprintf("<%s>; rel=%q", successor, "successor-version"))
+
+		c.Next()
+	}
+}
@@ -5,8 +5,8 @@ import (
 	"fmt"
 	"net/http"
 
-	"github.com/PopescuStefanRadu/ent-demo/pkg/ent"
 	"github.com/PopescuStefanRadu/ent-demo/pkg/http/server/response"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/requestid"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 	"github.com/rs/zerolog"
@@ -16,19 +16,19 @@ type ErrorHandler struct {
 	Logger zerolog.Logger
 }
 
+// HandleErrors renders the errors collected during the request. When there are several errors, the response status
+// is the highest of the statuses they map to, so that a server side failure is never reported as a client error.
+//
+//nolint:funlen
 func (eh *ErrorHandler) HandleErrors(c *gin.Context) {
 	c.Next()
 	errs := c.Errors
 
-	if errs == nil {
+	if len(errs) == 0 { // gin reuses contexts, so errs can be empty but not nil
 		return
 	}
 
 	var (
-		//nolint:godox
-		// TODO do not use ent.NotFoundError, instead create a business error that wraps these cases.
-		notFound     *ent.NotFoundError
-		constraint   *ent.ConstraintError
 		responseErr  *response.Error
 		validatorErr validator.ValidationErrors
 	)
@@ -36,21 +36,22 @@ func (eh *ErrorHandler) HandleErrors(c *gin.Context) {
 	r := response.Response[*any]{
 		Errors: map[string][]response.Error{},
 	}
+	status := 0
 
 	for _, err := range errs {
+		var (
+			errStatus int
+			global    response.Error
+		)
+
 		switch {
 		case errors.As(err, &responseErr):
 			r.Errors[responseErr.Path] = append(r.Errors[responseErr.Path], *responseErr)
-		case errors.As(err, &notFound):
-			r.Errors["global"] = append(r.Errors["global"], response.Error{
-				Code:    "NotFound",
-				Message: "resource not found",
-			})
-		case errors.As(err, &constraint):
-			r.Errors["global"] = append(r.Errors["global"], response.Error{
-				Code:    "Constraint",
-				Message: err.Error(),
-			})
+
+			errStatus = responseErr.Status
+			if errStatus == 0 {
+				errStatus = http.StatusBadRequest
+			}
 		case errors.As(err, &validatorErr):
 			for _, fieldError := range validatorErr {
 				r.Errors[fieldError.Namespace()] = append(r.Errors[fieldError.Namespace()], response.Error{
@@ -58,15 +59,25 @@ func (eh *ErrorHandler) HandleErrors(c *gin.Context) {
 					Message: fmt.Sprintf("Validation for %s failed on the '%s' tag", fieldError.Field(), fieldError.ActualTag()),
 				})
 			}
+
+			errStatus = http.StatusBadRequest
+		case err.IsType(gin.ErrorTypeBind):
+			errStatus, global = http.StatusBadRequest, response.Error{Code: "BadRequest", Message: err.Error()}
 		default:
-			r.Errors["global"] = append(r.Errors["global"], response.Error{
-				Code:    "unknown",
-				Message: err.Error(),
-			})
+			errStatus, global = response.FromBusinessError(err.Err)
+		}
+
+		if global.Code != "" {
+			r.Errors["global"] = append(r.Errors["global"], global)
+		}
 
-			eh.Logger.Error().Msgf("Unhandled error of type %T", err)
+		if errStatus >= http.StatusInternalServerError {
+			l := requestid.Logger(c.Request.Context(), eh.Logger)
+			l.Err(err.Err).Int("status", errStatus).Msgf("Request failed with error of type %T", err.Err)
 		}
+
+		status = max(status, errStatus)
 	}
 
-	c.JSON(http.StatusNotFound, r)
+	c.JSON(status, r)
 }
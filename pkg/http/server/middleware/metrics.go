@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// unmatchedRoute labels the requests that match no route, so that unknown paths do not create new series.
+const unmatchedRoute = "unmatched"
+
+//nolint:gochecknoglobals
+var (
+	httpRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "entdemo",
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests, by method, route and status.",
+	}, []string{"method", "route", "status"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "entdemo",
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of the HTTP requests, by method, route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+)
+
+// Metrics counts the requests and measures their duration. Requests are labelled with their route, e.g. /user/:id,
+// rather than with their path. The metrics are registered with the default registry of prometheus.
+func Metrics(c *gin.Context) {
+	start := time.Now()
+
+	c.Next()
+
+	route := c.FullPath()
+	if route == "" {
+		route = unmatchedRoute
+	}
+
+	status := strconv.Itoa(c.Writer.Status())
+
+	httpRequestDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	httpRequestsTotal.WithLabelValues(c.Request.Method, route, status).Inc()
+}
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/PopescuStefanRadu/ent-demo/pkg/requestid"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestID correlates the logs of a request. It accepts the ID of the requestid.Header header, or generates one
+// when missing or invalid, echoes it in the response and stores it, with a logger that adds it to every line, in the
+// context of the request. The ID is also added to the span of the request.
+type RequestID struct {
+	Logger zerolog.Logger
+}
+
+func (m *RequestID) Handle(c *gin.Context) {
+	id := c.GetHeader(requestid.Header)
+	if !requestid.Valid(id) {
+		id = requestid.New()
+	}
+
+	trace.SpanFromContext(c.Request.Context()).SetAttributes(attribute.String("request.id", id))
+
+	l := m.Logger.With().Str(requestid.LogField, id).Logger()
+	ctx := l.WithContext(requestid.NewContext(c.Request.Context(), id))
+	c.Request = c.Request.WithContext(ctx)
+
+	c.Header(requestid.Header, id)
+	c.Next()
+}
+
+// AccessLog logs every request with the logger of its context, see RequestID.
+func AccessLog(c *gin.Context) {
+	start := time.Now()
+
+	c.Next()
+
+	status := c.Writer.Status()
+
+	event := zerolog.Ctx(c.Request.Context()).Info()
+	if status >= 500 { //nolint:gomnd
+		event = zerolog.Ctx(c.Request.Context()).Error()
+	}
+
+	event.
+		Str("method", c.Request.Method).
+		Str("path", c.Request.URL.Path).
+		Int("status", status).
+		Dur("latency", time.Since(start)).
+		Str("client_ip", c.ClientIP()).
+		Msg("Request handled")
+}
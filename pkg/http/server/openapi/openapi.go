@@ -0,0 +1,50 @@
+// Package openapi holds the OpenAPI 3 specification of the HTTP API, and serves it along with a Swagger UI. The
+// specification is written by hand in openapi.json; the tests of the server package check that it matches the routes
+// of server.NewRouter and the request and response types.
+package openapi
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	swaggerFiles "github.com/swaggo/files/v2"
+)
+
+// initializerFile configures the Swagger UI. It replaces the one of the distribution, which shows the pet store.
+const initializerFile = "/swagger-initializer.js"
+
+var (
+	//go:embed openapi.json
+	spec []byte
+
+	//go:embed swagger-initializer.js
+	initializer []byte
+)
+
+//nolint:gochecknoglobals
+var uiServer = http.FileServer(http.FS(swaggerFiles.FS))
+
+// Spec returns the specification, as JSON.
+func Spec() []byte {
+	return spec
+}
+
+// ServeSpec answers with the specification. The UI expects it at openapi.json, next to its docs/ directory.
+func ServeSpec(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json", spec)
+}
+
+// ServeUI serves the Swagger UI from a route ending with /docs/*filepath.
+func ServeUI(c *gin.Context) {
+	filepath := c.Param("filepath")
+	if filepath == initializerFile {
+		c.Data(http.StatusOK, "text/javascript; charset=utf-8", initializer)
+		return
+	}
+
+	req := c.Request.Clone(c.Request.Context())
+	req.URL.Path = filepath
+
+	uiServer.ServeHTTP(c.Writer, req)
+}
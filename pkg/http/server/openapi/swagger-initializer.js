@@ -0,0 +1,16 @@
+window.onload = function() {
+  // the UI is served under <prefix>/docs/ and the specification at <prefix>/openapi.json
+  window.ui = SwaggerUIBundle({
+    url: "../openapi.json",
+    dom_id: '#swagger-ui',
+    deepLinking: true,
+    presets: [
+      SwaggerUIBundle.presets.apis,
+      SwaggerUIStandalonePreset
+    ],
+    plugins: [
+      SwaggerUIBundle.plugins.DownloadUrl
+    ],
+    layout: "StandaloneLayout"
+  });
+};
@@ -0,0 +1,341 @@
+package server_test
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PopescuStefanRadu/ent-demo/pkg/app"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/http/server"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/http/server/openapi"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/http/server/request"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/http/server/response"
+	"github.com/stretchr/testify/require"
+)
+
+type specDoc struct {
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]*specSchema `json:"schemas"`
+	} `json:"components"`
+}
+
+type specSchema struct {
+	Type       string                 `json:"type"`
+	Format     string                 `json:"format"`
+	Ref        string                 `json:"$ref"`
+	Items      *specSchema            `json:"items"`
+	Properties map[string]*specSchema `json:"properties"`
+	Required   []string               `json:"required"`
+}
+
+//nolint:gochecknoglobals
+var (
+	// dtoSchemas maps the schemas of the specification to the types they describe.
+	dtoSchemas = map[string]any{
+		"CreateUser":       request.CreateUser{},
+		"CreateUsersBatch": request.CreateUsersBatch{},
+		"UpdateUser":       request.UpdateUserBody{},
+		"PatchUser":        request.PatchUserBody{},
+		"GetFilteredUsers": request.GetFilteredUsers{},
+		"TimeRange":        request.TimeRange{},
+		"User":             response.User{},
+		"Page":             response.Page{},
+		"Error":            response.Error{},
+	}
+	// envelopeSchemas describe response.Response for a given result.
+	envelopeSchemas = []string{"UserResponse", "UserBatchResponse", "UserPageResponse", "ErrorResponse"}
+	// notDTOs are the request and response types that have no schema of their own.
+	notDTOs = map[string]string{
+		"UpdateUserURI": "path parameter",
+		"ListUsers":     "query parameters, see TestOpenAPIMatchesQueryParameters",
+		"Response":      "see envelopeSchemas",
+	}
+)
+
+func loadSpec(t *testing.T) specDoc {
+	t.Helper()
+
+	var doc specDoc
+	require.NoError(t, json.Unmarshal(openapi.Spec(), &doc))
+
+	return doc
+}
+
+func TestOpenAPICoversRoutes(t *testing.T) {
+	r := require.New(t)
+	doc := loadSpec(t)
+
+	type operation struct{ method, path string }
+
+	documented := map[operation]bool{}
+
+	for path, item := range doc.Paths {
+		for method := range item {
+			if method != "parameters" {
+				documented[operation{strings.ToUpper(method), path}] = false
+			}
+		}
+	}
+
+	router := server.NewRouter(&app.App{}, server.RouterConfig{AdminToken: "token"})
+
+	for _, route := range router.Routes() {
+		pattern := specPathPattern(route.Path)
+		found := false
+
+		for op := range documented {
+			if op.method == route.Method && pattern.MatchString(op.path) {
+				documented[op] = true
+				found = true
+			}
+		}
+
+		r.True(found, "%s %s is not in openapi.json", route.Method, route.Path)
+	}
+
+	for op, routed := range documented {
+		r.True(routed, "%s %s of openapi.json is not routed", op.method, op.path)
+	}
+}
+
+// specPathPattern matches the paths of the specification that a gin path serves: /user/:id serves /user/{id}, and the
+// custom methods route /users:method serves /users:batch.
+func specPathPattern(ginPath string) *regexp.Regexp {
+	segments := strings.Split(ginPath, "/")
+
+	for i, segment := range segments {
+		switch {
+		case strings.HasPrefix(segment, ":"), strings.HasPrefix(segment, "*"):
+			segments[i] = regexp.QuoteMeta("{" + segment[1:] + "}")
+		case strings.Contains(segment, ":"):
+			prefix, _, _ := strings.Cut(segment, ":")
+			segments[i] = regexp.QuoteMeta(prefix) + ":[a-zA-Z]+"
+		default:
+			segments[i] = regexp.QuoteMeta(segment)
+		}
+	}
+
+	return regexp.MustCompile("^" + strings.Join(segments, "/") + "$")
+}
+
+func TestOpenAPIMatchesDTOs(t *testing.T) {
+	doc := loadSpec(t)
+
+	schemaNames := map[reflect.Type]string{}
+	for name, dto := range dtoSchemas {
+		schemaNames[reflect.TypeOf(dto)] = name
+	}
+
+	for name, dto := range dtoSchemas {
+		nameCpy, dto := name, dto
+
+		t.Run(nameCpy, func(t *testing.T) {
+			r := require.New(t)
+
+			schema, ok := doc.Components.Schemas[nameCpy]
+			r.True(ok, "no schema in openapi.json")
+
+			fields := jsonFields(reflect.TypeOf(dto))
+
+			properties := map[string]string{}
+			for property, s := range schema.Properties {
+				properties[property] = s.shape()
+			}
+
+			expected := map[string]string{}
+			required := []string{}
+
+			for name, field := range fields {
+				expected[name] = goShape(field.Type, schemaNames)
+
+				if strings.Contains(field.Tag.Get("binding"), "required") {
+					required = append(required, name)
+				}
+			}
+
+			sort.Strings(required)
+			sort.Strings(schema.Required)
+
+			r.Equal(expected, properties)
+			r.Equal(required, append([]string{}, schema.Required...))
+		})
+	}
+
+	envelope := jsonFields(reflect.TypeOf(response.Response[any]{}))
+
+	for _, name := range envelopeSchemas {
+		schema, ok := doc.Components.Schemas[name]
+		require.True(t, ok, "no schema %s in openapi.json", name)
+
+		for property := range schema.Properties {
+			require.Contains(t, envelope, property, "%s.%s is not a member of response.Response", name, property)
+		}
+	}
+
+	for name := range doc.Components.Schemas {
+		_, isDTO := dtoSchemas[name]
+		require.True(t, isDTO || name == "Errors" || slices.Contains(envelopeSchemas, name),
+			"schema %s of openapi.json describes no type", name)
+	}
+}
+
+func TestOpenAPIMatchesQueryParameters(t *testing.T) {
+	r := require.New(t)
+	doc := loadSpec(t)
+
+	var op struct {
+		Parameters []struct {
+			Name   string      `json:"name"`
+			In     string      `json:"in"`
+			Schema *specSchema `json:"schema"`
+		} `json:"parameters"`
+	}
+	r.NoError(json.Unmarshal(doc.Paths["/v1/users"]["get"], &op))
+
+	parameters := map[string]string{}
+
+	for _, p := range op.Parameters {
+		r.Equal("query", p.In, p.Name)
+		parameters[p.Name] = p.Schema.shape()
+	}
+
+	expected := map[string]string{}
+
+	listUsers := reflect.TypeOf(request.ListUsers{})
+	for i := 0; i < listUsers.NumField(); i++ {
+		field := listUsers.Field(i)
+		expected[field.Tag.Get("form")] = goShape(field.Type, nil)
+	}
+
+	r.Equal(expected, parameters)
+}
+
+// TestOpenAPIListsAllDTOs fails when a request or response type is added without a schema.
+func TestOpenAPIListsAllDTOs(t *testing.T) {
+	described := map[string]bool{}
+	for _, dto := range dtoSchemas {
+		described[reflect.TypeOf(dto).Name()] = true
+	}
+
+	for _, dir := range []string{"request", "response"} {
+		pkgs, err := parser.ParseDir(token.NewFileSet(), dir, nil, 0)
+		require.NoError(t, err)
+
+		for _, pkg := range pkgs {
+			for _, file := range pkg.Files {
+				for name, obj := range file.Scope.Objects {
+					spec, ok := obj.Decl.(*ast.TypeSpec)
+					if !ok || !ast.IsExported(name) {
+						continue
+					}
+
+					if _, ok := spec.Type.(*ast.StructType); !ok {
+						continue
+					}
+
+					_, skipped := notDTOs[name]
+					require.True(t, described[name] || skipped, "%s.%s has no schema in openapi.json", dir, name)
+				}
+			}
+		}
+	}
+}
+
+func TestOpenAPIServed(t *testing.T) {
+	r := require.New(t)
+	router := server.NewRouter(&app.App{}, server.RouterConfig{})
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+		return w
+	}
+
+	w := get("/openapi.json")
+	r.Equal(http.StatusOK, w.Code)
+	r.JSONEq(string(openapi.Spec()), w.Body.String())
+
+	w = get("/docs/")
+	r.Equal(http.StatusOK, w.Code)
+	r.Contains(w.Body.String(), "swagger-ui")
+
+	w = get("/docs/swagger-initializer.js")
+	r.Equal(http.StatusOK, w.Code)
+	r.Contains(w.Body.String(), `"../openapi.json"`)
+}
+
+// jsonFields returns the fields of t by their JSON name.
+func jsonFields(t reflect.Type) map[string]reflect.StructField {
+	fields := map[string]reflect.StructField{}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		fields[name] = field
+	}
+
+	return fields
+}
+
+// shape summarizes the type of a schema, e.g. array<#/components/schemas/User>. Formats are kept only for dates,
+// which have a Go type of their own.
+func (s *specSchema) shape() string {
+	switch {
+	case s.Ref != "":
+		return s.Ref
+	case s.Type == "array" && s.Items != nil:
+		return "array<" + s.Items.shape() + ">"
+	case s.Format == "date-time":
+		return s.Type + "(date-time)"
+	default:
+		return s.Type
+	}
+}
+
+func goShape(t reflect.Type, schemaNames map[reflect.Type]string) string {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if name, ok := schemaNames[t]; ok {
+		return "#/components/schemas/" + name
+	}
+
+	switch {
+	case t == reflect.TypeOf(time.Time{}):
+		return "string(date-time)"
+	case t.Kind() == reflect.String:
+		return "string"
+	case t.Kind() == reflect.Bool:
+		return "boolean"
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return "integer"
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return "number"
+	case t.Kind() == reflect.Slice:
+		return "array<" + goShape(t.Elem(), schemaNames) + ">"
+	default:
+		return "unsupported " + t.String()
+	}
+}
@@ -1,10 +1,25 @@
 package request
 
+import (
+	"encoding/json"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
 type CreateUser struct {
 	Username string `json:"username"`
 	Email    string `json:"email"`
 }
 
+// CreateUsersBatch creates up to user.MaxBatchSize users, see user.BatchMode for the modes. The service enforces the
+// limit.
+type CreateUsersBatch struct {
+	Mode  string       `binding:"required,oneof=all_or_nothing best_effort" json:"mode"`
+	Users []CreateUser `binding:"required,min=1,dive"                       json:"users"`
+}
+
 type UpdateUserURI struct {
 	ID int `binding:"required" uri:"id"`
 }
@@ -14,6 +29,91 @@ type UpdateUserBody struct {
 	Email    string `json:"email"`
 }
 
+// GetFilteredUsers is the body of a user search. Sort holds field names, prefixed with '-' for descending order.
 type GetFilteredUsers struct {
-	IdsIn []int `json:"ids_in"`
+	IdsIn          []int     `json:"ids_in"`
+	Username       string    `json:"username"`
+	UsernamePrefix string    `json:"username_prefix"`
+	EmailDomain    string    `json:"email_domain"`
+	CreatedAt      TimeRange `json:"created_at"`
+	UpdatedAt      TimeRange `json:"updated_at"`
+	//nolint:lll
+	Sort  []string `binding:"dive,oneof=id -id username -username email -email created_at -created_at updated_at -updated_at" json:"sort"`
+	Limit int      `binding:"omitempty,min=1,max=1000" json:"limit"`
+	After string   `json:"after"`
+}
+
+// TimeRange includes From and excludes To.
+type TimeRange struct {
+	From *time.Time `json:"from"`
+	To   *time.Time `json:"to"`
+}
+
+// MergePatchContentType is the media type of JSON Merge Patch (RFC 7396) bodies, see PatchUserBody.
+const MergePatchContentType = "application/merge-patch+json"
+
+// PatchUserBody is a JSON Merge Patch of a user. Nil fields were absent from the patch, and Nulls lists the members
+// that were explicitly set to null, i.e. that the patch removes.
+type PatchUserBody struct {
+	Username *string  `json:"username"`
+	Email    *string  `json:"email"`
+	Nulls    []string `json:"-"`
+}
+
+func (p *PatchUserBody) UnmarshalJSON(b []byte) error {
+	type patch PatchUserBody
+
+	if err := json.Unmarshal(b, (*patch)(p)); err != nil {
+		return err
+	}
+
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(b, &members); err != nil {
+		return err
+	}
+
+	// encoding/json matches the members to the fields case-insensitively, e.g. "Email" sets Email
+	for name, value := range members {
+		for _, field := range []string{"username", "email"} {
+			if string(value) == "null" && strings.EqualFold(name, field) {
+				p.Nulls = append(p.Nulls, field)
+			}
+		}
+	}
+
+	sort.Strings(p.Nulls)
+	p.Nulls = slices.Compact(p.Nulls)
+
+	return nil
+}
+
+// ListUsers holds the query-string filters of GET /v1/users, the counterpart of GetFilteredUsers. Lists are passed as
+// repeated parameters, e.g. ?ids_in=1&ids_in=2&sort=-created_at, and times in RFC 3339.
+type ListUsers struct {
+	IdsIn          []int      `form:"ids_in"`
+	Username       string     `form:"username"`
+	UsernamePrefix string     `form:"username_prefix"`
+	EmailDomain    string     `form:"email_domain"`
+	CreatedFrom    *time.Time `form:"created_from"`
+	CreatedTo      *time.Time `form:"created_to"`
+	UpdatedFrom    *time.Time `form:"updated_from"`
+	UpdatedTo      *time.Time `form:"updated_to"`
+	//nolint:lll
+	Sort  []string `binding:"dive,oneof=id -id username -username email -email created_at -created_at updated_at -updated_at" form:"sort"`
+	Limit int      `binding:"omitempty,min=1,max=1000" form:"limit"`
+	After string   `form:"after"`
+}
+
+func (q *ListUsers) GetFilteredUsers() GetFilteredUsers {
+	return GetFilteredUsers{
+		IdsIn:          q.IdsIn,
+		Username:       q.Username,
+		UsernamePrefix: q.UsernamePrefix,
+		EmailDomain:    q.EmailDomain,
+		CreatedAt:      TimeRange{From: q.CreatedFrom, To: q.CreatedTo},
+		UpdatedAt:      TimeRange{From: q.UpdatedFrom, To: q.UpdatedTo},
+		Sort:           q.Sort,
+		Limit:          q.Limit,
+		After:          q.After,
+	}
 }
@@ -0,0 +1,47 @@
+package response
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/PopescuStefanRadu/ent-demo/pkg/user"
+)
+
+// FromBusinessError maps the business errors of the user package to an HTTP status and an Error. Any other error is
+// unexpected and maps to http.StatusInternalServerError.
+func FromBusinessError(err error) (int, Error) {
+	switch {
+	case errors.Is(err, user.ErrNotFound):
+		return http.StatusNotFound, Error{Cause: err, Code: "NotFound", Message: "resource not found"}
+	case errors.Is(err, user.ErrEmailTaken):
+		return http.StatusConflict, Error{Cause: err, Code: "Conflict", Message: user.ErrEmailTaken.Error()}
+	case errors.Is(err, user.ErrConflict):
+		return http.StatusConflict, Error{
+			Cause:   err,
+			Code:    "Conflict",
+			Message: "the change conflicts with the current state of the resource",
+		}
+	case errors.Is(err, user.ErrVersionMismatch):
+		return http.StatusPreconditionFailed, Error{
+			Cause:   err,
+			Code:    "VersionMismatch",
+			Message: "the resource has been modified since it was read",
+		}
+	case errors.Is(err, user.ErrInvalidInput):
+		return http.StatusUnprocessableEntity, Error{Cause: err, Code: "InvalidInput", Message: err.Error()}
+	case errors.Is(err, user.ErrDependencyUnavailable):
+		return http.StatusServiceUnavailable, Error{
+			Cause:   err,
+			Code:    "DependencyUnavailable",
+			Message: "a required dependency is temporarily unavailable",
+		}
+	case errors.Is(err, user.ErrDependencyFailure):
+		return http.StatusBadGateway, Error{
+			Cause:   err,
+			Code:    "DependencyFailure",
+			Message: "a required dependency failed to respond correctly",
+		}
+	default:
+		return http.StatusInternalServerError, Error{Cause: err, Code: "unknown", Message: err.Error()}
+	}
+}
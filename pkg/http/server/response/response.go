@@ -2,12 +2,24 @@ package response
 
 type Response[T any] struct {
 	Result T                  `json:"result,omitempty"`
+	Page   *Page              `json:"page,omitempty"`
 	Errors map[string][]Error `json:"errors,omitempty"`
+	// Warnings report problems that did not prevent the request from succeeding, keyed by path like Errors.
+	Warnings map[string][]Error `json:"warnings,omitempty"`
+}
+
+// Page describes the position of a paginated Result. NextCursor is passed as `after` to get the following page and is
+// omitted on the last one.
+type Page struct {
+	Limit      int    `json:"limit"`
+	NextCursor string `json:"next_cursor,omitempty"`
 }
 
 type Error struct {
-	Cause   error  `json:"-"`
-	Path    string `json:"-"`
+	Cause error  `json:"-"`
+	Path  string `json:"-"`
+	// Status is the HTTP status of the response, http.StatusBadRequest if not set.
+	Status  int    `json:"-"`
 	Code    string `json:"code,omitempty"`
 	Message string `json:"message,omitempty"`
 }
@@ -9,4 +9,5 @@ type User struct {
 	DogPhotoURL string    `json:"dog_photo_url"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
+	Version     int       `json:"version"`
 }
@@ -2,17 +2,54 @@ package server
 
 import (
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/PopescuStefanRadu/ent-demo/pkg/app"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/auth"
 	"github.com/PopescuStefanRadu/ent-demo/pkg/http/server/controller"
 	"github.com/PopescuStefanRadu/ent-demo/pkg/http/server/middleware"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/http/server/openapi"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/http/server/response"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/telemetry"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
-func NewRouter(app *app.App) *gin.Engine {
-	g := gin.Default()
+type RouterConfig struct {
+	// AdminToken grants access to the /admin routes. The routes are not registered when it is empty.
+	AdminToken string
+	// Verifier authenticates the callers of the API, all routes but the health, metrics and documentation ones. The
+	// API is public when it is nil.
+	Verifier *auth.Verifier
+	// ServiceName names the server in the spans of the requests. Defaults to telemetry.DefaultServiceName.
+	ServiceName string
+	// LegacySunset is when the unversioned routes are removed, announced in their Sunset header. Defaults to
+	// DefaultLegacySunset.
+	LegacySunset time.Time
+}
+
+// The unversioned routes are deprecated since LegacyDeprecation, in favour of the /v1 ones.
+//
+//nolint:gochecknoglobals
+var (
+	LegacyDeprecation   = time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC)
+	DefaultLegacySunset = time.Date(2027, time.April, 30, 0, 0, 0, 0, time.UTC)
+)
+
+func NewRouter(app *app.App, config RouterConfig) *gin.Engine {
+	g := gin.New()
+
+	serviceName := config.ServiceName
+	if serviceName == "" {
+		serviceName = telemetry.DefaultServiceName
+	}
+
+	requestID := &middleware.RequestID{Logger: app.Logger}
+	g.Use(otelgin.Middleware(serviceName), requestID.Handle, middleware.AccessLog, middleware.Metrics, gin.Recovery())
 
-	userCtl := controller.User{UserService: app.Service}
+	userCtl := &controller.User{UserService: app.Service}
 	errorHandler := &middleware.ErrorHandler{Logger: app.Logger}
 
 	grp := g.Use(errorHandler.HandleErrors)
@@ -21,11 +58,97 @@ func NewRouter(app *app.App) *gin.Engine {
 		c.JSON(http.StatusOK, gin.H{"status": "UP"})
 	})
 
-	grp.GET("/user/:id", userCtl.Get)
-	grp.POST("/user", userCtl.Create)
-	grp.PUT("/user/:id", userCtl.Update)
-	grp.DELETE("/user/:id", userCtl.Delete)
-	grp.POST("/search-users", userCtl.GetFiltered)
+	grp.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	grp.GET("/openapi.json", openapi.ServeSpec)
+	grp.GET("/docs/*filepath", openapi.ServeUI)
+
+	var adminOnly *middleware.AdminOnly
+	if config.AdminToken != "" {
+		adminOnly = &middleware.AdminOnly{Token: config.AdminToken}
+	}
+
+	var authenticated gin.HandlersChain
+	if config.Verifier != nil {
+		authenticate := &middleware.Authenticate{Verifier: config.Verifier}
+		authenticated = append(authenticated, authenticate.Handle)
+	}
+
+	v1Routes(g.Group("/v1", authenticated...), userCtl, adminOnly)
+
+	sunset := config.LegacySunset
+	if sunset.IsZero() {
+		sunset = DefaultLegacySunset
+	}
+
+	legacyRoutes(g.Group("", authenticated...), userCtl, adminOnly, &middleware.Deprecated{
+		Since:  LegacyDeprecation,
+		Sunset: sunset,
+	})
 
 	return g
 }
+
+// v1Routes registers version 1 of the API. A new version gets a function of its own, registered on its own group
+// next to the previous ones, e.g. v2Routes(g.Group("/v2"), ...), and deprecates them with middleware.Deprecated once
+// it is complete. The admin routes are skipped when adminOnly is nil.
+func v1Routes(v1 *gin.RouterGroup, userCtl *controller.User, adminOnly *middleware.AdminOnly) {
+	v1.GET("/users", userCtl.List)
+	v1.POST("/users", userCtl.Create)
+	v1.POST("/users:method", customMethods(map[string]gin.HandlerFunc{
+		"batch": userCtl.CreateBatch,
+	}))
+	v1.GET("/users/:id", userCtl.Get)
+	v1.PUT("/users/:id", userCtl.Update)
+	v1.PATCH("/users/:id", userCtl.Patch)
+	v1.DELETE("/users/:id", userCtl.Delete)
+	v1.POST("/users/:id/restore", userCtl.Restore)
+	v1.POST("/users/:id/dog-photo/refresh", userCtl.RefreshDogPhoto)
+
+	if adminOnly != nil {
+		admin := v1.Group("/admin", adminOnly.Authorize)
+
+		admin.DELETE("/users/:id", userCtl.Purge)
+	}
+}
+
+// legacyRoutes registers the routes that predate the versioning of the API, as deprecated aliases of the /v1 ones.
+func legacyRoutes(
+	g *gin.RouterGroup, userCtl *controller.User, adminOnly *middleware.AdminOnly, deprecated *middleware.Deprecated,
+) {
+	g.GET("/user/:id", deprecated.Successor("/v1/users/:id"), userCtl.Get)
+	g.POST("/user", deprecated.Successor("/v1/users"), userCtl.Create)
+	g.POST("/users:method", deprecated.Successor("/v1/users:method"), customMethods(map[string]gin.HandlerFunc{
+		"batch": userCtl.CreateBatch,
+	}))
+	g.PUT("/user/:id", deprecated.Successor("/v1/users/:id"), userCtl.Update)
+	g.PATCH("/user/:id", deprecated.Successor("/v1/users/:id"), userCtl.Patch)
+	g.DELETE("/user/:id", deprecated.Successor("/v1/users/:id"), userCtl.Delete)
+	g.POST("/user/:id/restore", deprecated.Successor("/v1/users/:id/restore"), userCtl.Restore)
+	g.POST("/user/:id/dog-photo/refresh", deprecated.Successor("/v1/users/:id/dog-photo/refresh"), userCtl.RefreshDogPhoto)
+	g.POST("/search-users", deprecated.Successor("/v1/users"), userCtl.GetFiltered)
+
+	if adminOnly != nil {
+		admin := g.Group("/admin", adminOnly.Authorize)
+
+		admin.DELETE("/user/:id", deprecated.Successor("/v1/admin/users/:id"), userCtl.Purge)
+	}
+}
+
+// customMethods routes custom methods (https://google.aip.dev/136) such as POST /users:batch. Gin reads a ':' as the
+// start of a path parameter, so the route is registered as /users:method, whose parameter holds ":batch".
+func customMethods(handlers map[string]gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		method, found := strings.CutPrefix(c.Param("method"), ":")
+		if handler, ok := handlers[method]; found && ok {
+			handler(c)
+			return
+		}
+
+		_ = c.Error(&response.Error{
+			Path:    "global",
+			Status:  http.StatusNotFound,
+			Code:    "NotFound",
+			Message: "resource not found",
+		})
+	}
+}
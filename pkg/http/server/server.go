@@ -3,10 +3,12 @@ package server
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/PopescuStefanRadu/ent-demo/pkg/app"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/auth"
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog"
 )
@@ -17,6 +19,11 @@ type Config struct {
 	ShutdownTimeout time.Duration
 	Address         string
 	AppConfig       *app.Config
+	RouterConfig    RouterConfig
+	// Auth sets RouterConfig.Verifier. It must be enabled, unless AuthDisabled explicitly serves the API without
+	// authentication.
+	Auth         auth.Config
+	AuthDisabled bool
 }
 
 type HTTPServer struct {
@@ -28,12 +35,26 @@ type HTTPServer struct {
 }
 
 func NewHTTPServer(config Config, logger zerolog.Logger) (*HTTPServer, error) {
+	var err error
+
+	switch {
+	case config.Auth.Enabled():
+		config.RouterConfig.Verifier, err = auth.NewVerifier(config.Auth)
+		if err != nil {
+			return nil, err
+		}
+	case config.AuthDisabled:
+		logger.Warn().Msg("Authentication is disabled, the API is public")
+	default:
+		return nil, fmt.Errorf("%w: a secret or a JWKS file is required, unless authentication is disabled", auth.ErrInvalid)
+	}
+
 	app, err := app.NewAppFromConfig(logger, config.AppConfig)
 	if err != nil {
 		return nil, err
 	}
 
-	router := NewRouter(app)
+	router := NewRouter(app, config.RouterConfig)
 	srv := &http.Server{
 		Addr:              config.Address,
 		Handler:           router,
@@ -55,6 +76,9 @@ func (h *HTTPServer) Start(ctx context.Context) error {
 		return err
 	}
 
+	stopWorkers := h.App.Start(ctx)
+	defer stopWorkers()
+
 	serverErr := make(chan error)
 	defer close(serverErr)
 
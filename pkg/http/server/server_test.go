@@ -1,20 +1,34 @@
 package server_test
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/PopescuStefanRadu/ent-demo/pkg/app"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/auth"
 	"github.com/PopescuStefanRadu/ent-demo/pkg/external/dog"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/external/dog/dogtest"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/external/photo"
 	"github.com/PopescuStefanRadu/ent-demo/pkg/http/server"
+	"github.com/PopescuStefanRadu/ent-demo/pkg/requestid"
 	"github.com/cenkalti/backoff/v4"
 	"github.com/rs/zerolog"
+	"github.com/sony/gobreaker"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
 )
 
 //nolint:funlen
@@ -36,14 +50,18 @@ func TestStartAndGracefulShutdown(t *testing.T) {
 	port, err := getFreePort()
 	require.NoError(t, err)
 
+	dbDialect, dbURL := app.TestDBConfig()
+
 	subject, err := server.NewHTTPServer(server.Config{
 		ShutdownTimeout: 5 * time.Second,
 		Address:         fmt.Sprintf(":%d", port),
 		AppConfig: &app.Config{
-			DBUrl:            "file:ent?mode=memory&cache=shared&_fk=1",
+			DBDialect:        dbDialect,
+			DBUrl:            dbURL,
 			DebugPersistence: true,
-			DogClientConfig:  dog.ClientConfig{},
+			MigrateOnStart:   true,
 		},
+		AuthDisabled: true,
 	}, l)
 	require.NoError(t, err)
 
@@ -88,3 +106,217 @@ func TestStartAndGracefulShutdown(t *testing.T) {
 	require.NoError(t, subject.Start(ctx))
 	require.NoError(t, <-errCh)
 }
+
+func TestNewHTTPServerRequiresAuth(t *testing.T) {
+	dbDialect, dbURL := app.TestDBConfig()
+
+	_, err := server.NewHTTPServer(server.Config{
+		AppConfig: &app.Config{DBDialect: dbDialect, DBUrl: dbURL},
+	}, zerolog.New(zerolog.NewTestWriter(t)))
+	require.ErrorIs(t, err, auth.ErrInvalid)
+}
+
+func TestRequestID(t *testing.T) {
+	var logs bytes.Buffer
+
+	dbDialect, dbURL := app.TestDBConfig()
+
+	a, err := app.NewAppFromConfig(zerolog.New(&logs), &app.Config{
+		DBDialect:        dbDialect,
+		DBUrl:            dbURL,
+		DebugPersistence: true,
+		MigrateOnStart:   true,
+	})
+	require.NoError(t, err)
+	require.NoError(t, a.Init(context.Background()))
+
+	router := server.NewRouter(a, server.RouterConfig{})
+
+	tests := []struct {
+		name     string
+		path     string
+		received string
+		echoed   func(id string) bool
+	}{
+		{name: "accepted", received: "abc-123", echoed: func(id string) bool { return id == "abc-123" }},
+		{name: "carried by the queries", path: "/user/999999", received: "abc-456", echoed: func(id string) bool {
+			return id == "abc-456"
+		}},
+		{name: "generated when missing", echoed: func(id string) bool { return len(id) == 32 }},
+		{name: "generated when invalid", received: "with space", echoed: func(id string) bool { return len(id) == 32 }},
+		{name: "generated when too long", received: strings.Repeat("a", requestid.MaxLength+1), echoed: func(id string) bool {
+			return len(id) == 32
+		}},
+	}
+
+	for _, tt := range tests {
+		ttCpy := tt
+		t.Run(tt.name, func(t *testing.T) {
+			r := require.New(t)
+			logs.Reset()
+
+			path := ttCpy.path
+			if path == "" {
+				path = "/health"
+			}
+
+			req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, path, nil)
+			r.NoError(err)
+
+			if ttCpy.received != "" {
+				req.Header.Set(requestid.Header, ttCpy.received)
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			id := w.Header().Get(requestid.Header)
+			r.True(ttCpy.echoed(id), id)
+
+			if ttCpy.path != "" {
+				r.Contains(logs.String(), "ent: ")
+			}
+
+			for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+				r.Contains(line, fmt.Sprintf(`"request_id":%q`, id))
+			}
+		})
+	}
+}
+
+//nolint:funlen
+func TestTracing(t *testing.T) {
+	r := require.New(t)
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+		_ = provider.Shutdown(context.Background())
+	})
+
+	traceparents := make(chan string, 1)
+	stub := dogtest.NewHandler(dogtest.Config{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparents <- r.Header.Get("traceparent")
+		stub.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	dbDialect, dbURL := app.TestDBConfig()
+	a, err := app.NewAppFromConfig(zerolog.New(zerolog.NewTestWriter(t)), &app.Config{
+		DBDialect:      dbDialect,
+		DBUrl:          dbURL,
+		MigrateOnStart: true,
+		PhotoProvider:  photo.ProviderConfig{Type: photo.TypeRandomDog, HTTP: dog.ClientConfig{BaseURL: srv.URL}},
+	})
+	r.NoError(err)
+	r.NoError(a.Init(context.Background()))
+
+	t.Cleanup(func() {
+		_ = a.Cleanup(context.Background())
+	})
+
+	router := server.NewRouter(a, server.RouterConfig{})
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, "/user",
+		strings.NewReader(`{"username": "traced", "email": "traced@example.com"}`))
+	r.NoError(err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	r.Equal(http.StatusOK, w.Code, w.Body.String())
+
+	// the dog API is called within the trace of the request
+	r.Contains(<-traceparents, traceID)
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		r.Equal(traceID, span.SpanContext().TraceID().String(), span.Name())
+		spans[span.Name()] = span
+	}
+
+	r.Contains(spans, "/user")
+	r.Contains(spans, "ent.Query")
+	r.Contains(spans, "GET /woof.json")
+	r.Contains(spans["/user"].Attributes(), attribute.String("request.id", w.Header().Get(requestid.Header)))
+	r.Contains(spans["ent.Query"].Attributes(), semconv.DBSystemSqlite)
+
+	dogSpan, ok := spans["dog.GetRandomDogURL"]
+	r.True(ok)
+	r.Contains(dogSpan.Attributes(), attribute.String("dog.circuit_breaker.state", "closed"))
+	r.Equal(dogSpan.SpanContext().SpanID(), spans["GET /woof.json"].Parent().SpanID())
+}
+
+//nolint:funlen
+func TestMetrics(t *testing.T) {
+	r := require.New(t)
+
+	stub := dogtest.NewServer(dogtest.Config{})
+	t.Cleanup(stub.Close)
+
+	dbDialect, dbURL := app.TestDBConfig()
+	a, err := app.NewAppFromConfig(zerolog.New(zerolog.NewTestWriter(t)), &app.Config{
+		DBDialect:      dbDialect,
+		DBUrl:          dbURL,
+		MigrateOnStart: true,
+		PhotoProvider: photo.ProviderConfig{Type: photo.TypeRandomDog, HTTP: dog.ClientConfig{
+			BaseURL: stub.URL,
+			CircuitBreakerSettings: gobreaker.Settings{
+				Name:        "metrics-test",
+				ReadyToTrip: func(counts gobreaker.Counts) bool { return counts.ConsecutiveFailures >= 1 },
+			},
+		}},
+	})
+	r.NoError(err)
+	r.NoError(a.Init(context.Background()))
+
+	t.Cleanup(func() {
+		_ = a.Cleanup(context.Background())
+	})
+
+	router := server.NewRouter(a, server.RouterConfig{})
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequestWithContext(context.Background(), method, path, strings.NewReader(body))
+		r.NoError(err)
+		req.Header.Set("Content-Type", "application/json")
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		return w
+	}
+
+	r.Equal(http.StatusOK, do(http.MethodPost, "/user", `{"username": "metered", "email": "metered@example.com"}`).Code)
+	r.Equal(http.StatusNotFound, do(http.MethodGet, "/user/999999", "").Code)
+	r.Equal(http.StatusNotFound, do(http.MethodGet, "/not/a/route", "").Code)
+
+	// trips the breaker
+	stub.Stub.SetConfig(dogtest.Config{ErrorRate: 1})
+	do(http.MethodPost, "/user", `{"username": "unmetered", "email": "unmetered@example.com"}`)
+
+	w := do(http.MethodGet, "/metrics", "")
+	r.Equal(http.StatusOK, w.Code)
+
+	metrics := w.Body.String()
+	r.Contains(metrics, `entdemo_http_requests_total{method="POST",route="/user",status="200"}`)
+	r.Contains(metrics, `entdemo_http_requests_total{method="GET",route="/user/:id",status="404"}`)
+	r.Contains(metrics, `entdemo_http_requests_total{method="GET",route="unmatched",status="404"}`)
+	r.Contains(metrics, `entdemo_http_request_duration_seconds_count{method="GET",route="/user/:id",status="404"}`)
+	r.Contains(metrics, fmt.Sprintf(`entdemo_db_queries_total{dialect=%q,operation="query",outcome="success"}`, dbDialect))
+	r.Contains(metrics, fmt.Sprintf(`entdemo_db_query_duration_seconds_count{dialect=%q,operation="query"}`, dbDialect))
+	r.Contains(metrics, `entdemo_dog_requests_total{api="random.dog",outcome="success"}`)
+	r.Contains(metrics, `entdemo_dog_requests_total{api="random.dog",outcome="failure"}`)
+	r.Contains(metrics, `entdemo_dog_circuit_breaker_state{name="metrics-test"} 2`)
+}
@@ -0,0 +1,91 @@
+// Package requestid carries the correlation ID of a request through its context, so that the logs and outbound calls
+// made on behalf of the request can be tied together.
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/rs/zerolog"
+)
+
+// Header carries the ID on incoming requests, responses and outbound requests.
+const Header = "X-Request-ID"
+
+// LogField is the field of the log lines that holds the ID.
+const LogField = "request_id"
+
+// MaxLength is the longest ID accepted from a client.
+const MaxLength = 128
+
+type ctxKey struct{}
+
+// NewContext returns a copy of ctx that carries id.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext returns the ID carried by ctx, if any.
+func FromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(ctxKey{}).(string)
+	return id, ok && id != ""
+}
+
+// New generates a random ID.
+func New() string {
+	b := make([]byte, 16) //nolint:gomnd
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// Valid accepts the IDs of up to MaxLength printable ASCII characters, so that a client cannot inject anything else
+// into the logs and headers.
+func Valid(id string) bool {
+	if id == "" || len(id) > MaxLength {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Logger returns l with the ID carried by ctx, if any.
+func Logger(ctx context.Context, l zerolog.Logger) zerolog.Logger {
+	if id, ok := FromContext(ctx); ok {
+		return l.With().Str(LogField, id).Logger()
+	}
+
+	return l
+}
+
+// Transport forwards the ID carried by the context of outbound requests in Header.
+type Transport struct {
+	// Base defaults to http.DefaultTransport.
+	Base http.RoundTripper
+}
+
+func (t Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	id, ok := FromContext(req.Context())
+	if !ok || req.Header.Get(Header) != "" {
+		return base.RoundTrip(req)
+	}
+
+	// a RoundTripper must not modify the request
+	req = req.Clone(req.Context())
+	req.Header.Set(Header, id)
+
+	return base.RoundTrip(req)
+}
@@ -0,0 +1,112 @@
+// Package telemetry sets up the OpenTelemetry tracing of the application: the exporter of the spans and the W3C trace
+// context propagation, through the global providers of otel.
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+// Exporters of the spans.
+const (
+	// ExporterNone records no span. Trace contexts are still propagated. It is the default.
+	ExporterNone = "none"
+	// ExporterStdout writes the spans to the standard output, as JSON.
+	ExporterStdout = "stdout"
+	// ExporterOTLP sends the spans to an OpenTelemetry collector, over OTLP/HTTP.
+	ExporterOTLP = "otlp"
+)
+
+// DefaultServiceName is used when Config.ServiceName is not set.
+const DefaultServiceName = "ent-demo"
+
+// Exporters lists the supported exporters.
+func Exporters() []string {
+	return []string{ExporterNone, ExporterStdout, ExporterOTLP}
+}
+
+type Config struct {
+	Exporter    string
+	ServiceName string
+	// OTLPEndpoint is the host and port of the collector, e.g. localhost:4318. When empty, the exporter reads the
+	// OTEL_EXPORTER_OTLP_ENDPOINT environment variable, and defaults to localhost:4318.
+	OTLPEndpoint string
+	// OTLPInsecure sends the spans over plain HTTP, e.g. to a local collector.
+	OTLPInsecure bool
+	// SampleRatio is the fraction, from 0 to 1, of the traces started by the application that are recorded. The
+	// traces started by the callers are recorded when the callers sampled them.
+	SampleRatio float64
+	// Stdout is where ExporterStdout writes, os.Stdout by default.
+	Stdout io.Writer
+}
+
+// Setup installs the global tracer provider and propagator. The returned function flushes the pending spans and
+// stops the exporter.
+func Setup(ctx context.Context, config Config) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	exporter, err := newExporter(ctx, config)
+	if err != nil || exporter == nil {
+		return func(context.Context) error { return nil }, err
+	}
+
+	serviceName := config.ServiceName
+	if serviceName == "" {
+		serviceName = DefaultServiceName
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(serviceName),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("could not create the telemetry resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+func newExporter(ctx context.Context, config Config) (sdktrace.SpanExporter, error) { //nolint:ireturn
+	switch config.Exporter {
+	case "", ExporterNone:
+		return nil, nil //nolint:nilnil
+	case ExporterStdout:
+		w := config.Stdout
+		if w == nil {
+			w = os.Stdout
+		}
+
+		return stdouttrace.New(stdouttrace.WithWriter(w))
+	case ExporterOTLP:
+		var opts []otlptracehttp.Option
+		if config.OTLPEndpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(config.OTLPEndpoint))
+		}
+
+		if config.OTLPInsecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+
+		return otlptracehttp.New(ctx, opts...)
+	default:
+		return nil, errors.New("unknown telemetry exporter " + config.Exporter)
+	}
+}
@@ -0,0 +1,33 @@
+package user
+
+import (
+	"context"
+
+	"github.com/PopescuStefanRadu/ent-demo/pkg/auth"
+	"github.com/rs/zerolog"
+)
+
+// Actions of the audit log lines.
+const (
+	AuditCreate          = "create"
+	AuditUpdate          = "update"
+	AuditRefreshDogPhoto = "refresh_dog_photo"
+	AuditDelete          = "delete"
+	AuditRestore         = "restore"
+	AuditPurge           = "purge"
+)
+
+// audit logs a change made to a user, with the subject of the caller as actor, see auth.FromContext. The actor is
+// empty when the request was not authenticated.
+func audit(ctx context.Context, action string, id int) {
+	var actor string
+	if claims, ok := auth.FromContext(ctx); ok {
+		actor = claims.Subject
+	}
+
+	zerolog.Ctx(ctx).Info().
+		Str("audit_action", action).
+		Str("audit_actor", actor).
+		Int("user_id", id).
+		Msg("User changed")
+}
@@ -0,0 +1,25 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Business errors. Implementations of Repository and Dog wrap their underlying errors with one of these, so that
+// callers can classify a failure with errors.Is without knowing anything about the persistence or transport layers.
+var (
+	// ErrNotFound is returned when the requested user does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a change conflicts with the current state, e.g. a duplicate unique field.
+	ErrConflict = errors.New("conflict")
+	// ErrEmailTaken is the ErrConflict returned when the email belongs to another user that is not deleted.
+	ErrEmailTaken = fmt.Errorf("%w: the email is already taken", ErrConflict)
+	// ErrVersionMismatch is returned when a change was based on a version of the user that is no longer current.
+	ErrVersionMismatch = errors.New("version mismatch")
+	// ErrInvalidInput is returned when the input is well-formed but violates a business rule.
+	ErrInvalidInput = errors.New("invalid input")
+	// ErrDependencyFailure is returned when an external dependency answered with an error or an unusable response.
+	ErrDependencyFailure = errors.New("dependency failure")
+	// ErrDependencyUnavailable is returned when an external dependency is known to be down and was not called.
+	ErrDependencyUnavailable = errors.New("dependency unavailable")
+)
@@ -54,6 +54,21 @@ func (mr *MockRepositoryMockRecorder) Create(ctx, createParams any) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockRepository)(nil).Create), ctx, createParams)
 }
 
+// CreateBulk mocks base method.
+func (m *MockRepository) CreateBulk(ctx context.Context, createParams []user.CreateUserParams) ([]user.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateBulk", ctx, createParams)
+	ret0, _ := ret[0].([]user.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateBulk indicates an expected call of CreateBulk.
+func (mr *MockRepositoryMockRecorder) CreateBulk(ctx, createParams any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateBulk", reflect.TypeOf((*MockRepository)(nil).CreateBulk), ctx, createParams)
+}
+
 // DeleteAll mocks base method.
 func (m *MockRepository) DeleteAll(ctx context.Context) (int, error) {
 	m.ctrl.T.Helper()
@@ -84,10 +99,10 @@ func (mr *MockRepositoryMockRecorder) DeleteByID(ctx, id any) *gomock.Call {
 }
 
 // FindAllByFilter mocks base method.
-func (m *MockRepository) FindAllByFilter(ctx context.Context, findParams *user.FindAllFilter) ([]user.User, error) {
+func (m *MockRepository) FindAllByFilter(ctx context.Context, findParams *user.FindAllFilter) (*user.Page, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "FindAllByFilter", ctx, findParams)
-	ret0, _ := ret[0].([]user.User)
+	ret0, _ := ret[0].(*user.Page)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
@@ -113,6 +128,35 @@ func (mr *MockRepositoryMockRecorder) GetByID(ctx, id any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByID", reflect.TypeOf((*MockRepository)(nil).GetByID), ctx, id)
 }
 
+// PurgeByID mocks base method.
+func (m *MockRepository) PurgeByID(ctx context.Context, id int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeByID", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PurgeByID indicates an expected call of PurgeByID.
+func (mr *MockRepositoryMockRecorder) PurgeByID(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeByID", reflect.TypeOf((*MockRepository)(nil).PurgeByID), ctx, id)
+}
+
+// RestoreByID mocks base method.
+func (m *MockRepository) RestoreByID(ctx context.Context, id int) (*user.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreByID", ctx, id)
+	ret0, _ := ret[0].(*user.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RestoreByID indicates an expected call of RestoreByID.
+func (mr *MockRepositoryMockRecorder) RestoreByID(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreByID", reflect.TypeOf((*MockRepository)(nil).RestoreByID), ctx, id)
+}
+
 // Update mocks base method.
 func (m *MockRepository) Update(ctx context.Context, updateParams *user.UpdateUserParams) (*user.User, error) {
 	m.ctrl.T.Helper()
@@ -128,6 +172,43 @@ func (mr *MockRepositoryMockRecorder) Update(ctx, updateParams any) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockRepository)(nil).Update), ctx, updateParams)
 }
 
+// MockUnitOfWork is a mock of UnitOfWork interface.
+type MockUnitOfWork struct {
+	ctrl     *gomock.Controller
+	recorder *MockUnitOfWorkMockRecorder
+}
+
+// MockUnitOfWorkMockRecorder is the mock recorder for MockUnitOfWork.
+type MockUnitOfWorkMockRecorder struct {
+	mock *MockUnitOfWork
+}
+
+// NewMockUnitOfWork creates a new mock instance.
+func NewMockUnitOfWork(ctrl *gomock.Controller) *MockUnitOfWork {
+	mock := &MockUnitOfWork{ctrl: ctrl}
+	mock.recorder = &MockUnitOfWorkMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockUnitOfWork) EXPECT() *MockUnitOfWorkMockRecorder {
+	return m.recorder
+}
+
+// WithinTx mocks base method.
+func (m *MockUnitOfWork) WithinTx(ctx context.Context, fn func(user.Repository) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WithinTx", ctx, fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WithinTx indicates an expected call of WithinTx.
+func (mr *MockUnitOfWorkMockRecorder) WithinTx(ctx, fn any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WithinTx", reflect.TypeOf((*MockUnitOfWork)(nil).WithinTx), ctx, fn)
+}
+
 // MockDog is a mock of Dog interface.
 type MockDog struct {
 	ctrl     *gomock.Controller
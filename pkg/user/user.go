@@ -2,8 +2,10 @@ package user
 
 import (
 	"context"
+	"fmt"
 	"time"
 
+	"github.com/rs/zerolog"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -16,134 +18,400 @@ type User struct {
 	DogPhotoURL string
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
+	// Version is incremented by every change of the user.
+	Version int
 }
 
 type CreateUserParams struct {
 	Username string
 	Email    string
+	// DogPhotoURL is filled in by the Service when the user is created.
+	DogPhotoURL string
+}
+
+// BatchMode decides what happens to a batch when some of its items fail.
+type BatchMode string
+
+const (
+	// BatchAllOrNothing creates either all the users of a batch or none of them.
+	BatchAllOrNothing BatchMode = "all_or_nothing"
+	// BatchBestEffort creates every user it can and reports the failures per item.
+	BatchBestEffort BatchMode = "best_effort"
+)
+
+// MaxBatchSize is the largest number of users that can be created in one batch.
+const MaxBatchSize = 1000
+
+// BatchResult is the outcome of one item of a batch. User is set if the user was created, and Err otherwise.
+// Warning is set when the user was created without a photo, see EnrichDegrade.
+type BatchResult struct {
+	User    *User
+	Err     error
+	Warning error
 }
 
+// EnrichmentMode decides what happens to the users whose photo cannot be fetched.
+type EnrichmentMode string
+
+const (
+	// EnrichStrict fails the creation of the user. It is the default.
+	EnrichStrict EnrichmentMode = "strict"
+	// EnrichDegrade creates the user with an empty DogPhotoURL, which can be filled later with
+	// Service.RefreshDogPhoto, and reports the failure as a warning.
+	EnrichDegrade EnrichmentMode = "degrade"
+)
+
+// DefaultEnrichmentConcurrency is used when EnrichmentConfig.MaxConcurrency is not set.
+const DefaultEnrichmentConcurrency = 16
+
+// EnrichmentConfig configures how the Service fetches the photos of new users.
+type EnrichmentConfig struct {
+	Mode EnrichmentMode
+	// MaxConcurrency is the maximum number of photos fetched at the same time for a batch.
+	MaxConcurrency int
+}
+
+// UpdateUserParams changes the fields that are not nil and leaves the others unchanged.
 type UpdateUserParams struct {
-	ID       int
-	Username string
-	Email    string
+	ID          int
+	Username    *string
+	Email       *string
+	DogPhotoURL *string
+	// Version is the version the update is based on. The update fails with ErrVersionMismatch if the user has changed
+	// since. Zero updates unconditionally.
+	Version int
 }
 
 type Service struct {
 	UserRepository Repository
+	UnitOfWork     UnitOfWork
 	DogClient      Dog
+	Enrichment     EnrichmentConfig
+}
+
+const (
+	// DefaultPageLimit is the page size used when FindAllFilter.Limit is not set.
+	DefaultPageLimit = 100
+	// MaxPageLimit is the largest page size that can be requested.
+	MaxPageLimit = 1000
+)
+
+// SortField is a user attribute by which results can be ordered.
+type SortField string
+
+const (
+	SortByID        SortField = "id"
+	SortByUsername  SortField = "username"
+	SortByEmail     SortField = "email"
+	SortByCreatedAt SortField = "created_at"
+	SortByUpdatedAt SortField = "updated_at"
+)
+
+type SortKey struct {
+	Field SortField
+	Desc  bool
+}
+
+// TimeRange is a half-open interval: From is inclusive and To is exclusive. A nil bound is unbounded.
+type TimeRange struct {
+	From *time.Time
+	To   *time.Time
 }
 
+// FindAllFilter selects users matching all the set criteria. Zero values are ignored.
 type FindAllFilter struct {
-	IdsIn []int
+	IdsIn          []int
+	Username       string
+	UsernamePrefix string
+	// EmailDomain matches the part of the email after '@'.
+	EmailDomain string
+	CreatedAt   TimeRange
+	UpdatedAt   TimeRange
+	// Sort lists the keys in order of precedence. Results are always ordered by ID last, which makes the order
+	// stable for pagination.
+	Sort []SortKey
+	// Limit is the maximum number of users in a page.
+	Limit int
+	// After is the opaque cursor of the previous page, as returned in Page.NextCursor. It is only valid with the
+	// same Sort.
+	After string
+}
+
+// Page is a slice of users in a stable order. NextCursor is empty when there are no more users.
+type Page struct {
+	Users      []User
+	Limit      int
+	NextCursor string
 }
 
 type Repository interface {
 	GetByID(ctx context.Context, id int) (*User, error)
-	FindAllByFilter(ctx context.Context, findParams *FindAllFilter) ([]User, error)
+	FindAllByFilter(ctx context.Context, findParams *FindAllFilter) (*Page, error)
 	Create(ctx context.Context, createParams *CreateUserParams) (*User, error)
+	// CreateBulk creates all the users or, if any of them cannot be created, none.
+	CreateBulk(ctx context.Context, createParams []CreateUserParams) ([]User, error)
 	Update(ctx context.Context, updateParams *UpdateUserParams) (*User, error)
+	// DeleteByID soft deletes a user: it is hidden from all other methods until restored.
 	DeleteByID(ctx context.Context, id int) error
+	RestoreByID(ctx context.Context, id int) (*User, error)
+	// PurgeByID permanently deletes a user, soft deleted or not.
+	PurgeByID(ctx context.Context, id int) error
+	// DeleteAll permanently deletes all users.
 	DeleteAll(ctx context.Context) (int, error)
 }
 
+// UnitOfWork runs several Repository calls atomically.
+type UnitOfWork interface {
+	// WithinTx calls fn with a Repository bound to a new transaction. The transaction is committed if fn returns nil
+	// and rolled back if it returns an error or panics. Transactions cannot be nested.
+	WithinTx(ctx context.Context, fn func(repo Repository) error) error
+}
+
 type Dog interface {
 	GetRandomDogURL(ctx context.Context) (string, error)
 }
 
+// WithinTx runs fn in a transaction, see UnitOfWork.
+func (s *Service) WithinTx(ctx context.Context, fn func(repo Repository) error) error {
+	return s.UnitOfWork.WithinTx(ctx, fn)
+}
+
 func (s *Service) GetUserByID(ctx context.Context, id int) (*User, error) {
-	user, err := s.UserRepository.GetByID(ctx, id)
+	return s.UserRepository.GetByID(ctx, id)
+}
+
+func (s *Service) FindAllUsersByFilter(ctx context.Context, filter *FindAllFilter) (*Page, error) {
+	return s.UserRepository.FindAllByFilter(ctx, filter)
+}
+
+// CreateUser creates a user with a random dog photo. If the photo cannot be fetched, nothing is created in
+// EnrichStrict mode, while in EnrichDegrade mode the user is created without photo and the failure is logged and
+// returned as warning, like in BatchResult.
+func (s *Service) CreateUser(ctx context.Context, u *CreateUserParams) (created *User, warning, err error) {
+	params := *u
+
+	url, err := s.DogClient.GetRandomDogURL(ctx)
 	if err != nil {
-		return nil, err
+		if s.Enrichment.Mode != EnrichDegrade {
+			return nil, nil, err
+		}
+
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Creating user without dog photo")
+		warning = err
 	}
 
-	return s.enrichWithDogURL(ctx, user)
-}
+	params.DogPhotoURL = url
 
-func (s *Service) FindAllUsersByFilter(ctx context.Context, filter *FindAllFilter) ([]User, error) {
-	users, err := s.UserRepository.FindAllByFilter(ctx, filter)
+	created, err = s.UserRepository.Create(ctx, &params)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return s.parallelEnrichWithDogUrls(ctx, users)
+	audit(ctx, AuditCreate, created.ID)
+
+	return created, warning, nil
+}
+
+// CreateUsers creates a batch of users. In BatchAllOrNothing mode any failure fails the whole call, while in
+// BatchBestEffort mode failures are only reported in the result of the item they belong to. In both modes, a photo
+// that cannot be fetched is a failure in EnrichStrict mode, and only a warning in EnrichDegrade mode.
+func (s *Service) CreateUsers(ctx context.Context, params []CreateUserParams, mode BatchMode) ([]BatchResult, error) {
+	if len(params) > MaxBatchSize {
+		return nil, fmt.Errorf("%w: batch of %d users exceeds the limit of %d", ErrInvalidInput, len(params), MaxBatchSize)
+	}
+
+	if len(params) == 0 {
+		return []BatchResult{}, nil
+	}
+
+	switch mode {
+	case BatchAllOrNothing:
+		return s.createUsersAllOrNothing(ctx, params)
+	case BatchBestEffort:
+		return s.createUsersBestEffort(ctx, params), nil
+	default:
+		return nil, fmt.Errorf("%w: unknown batch mode %q", ErrInvalidInput, mode)
+	}
 }
 
-func (s *Service) CreateUser(ctx context.Context, u *CreateUserParams) (*User, error) {
-	created, err := s.UserRepository.Create(ctx, u)
+func (s *Service) createUsersAllOrNothing(ctx context.Context, params []CreateUserParams) ([]BatchResult, error) {
+	strict := s.Enrichment.Mode != EnrichDegrade
+
+	urls, urlErrs, err := s.parallelGetDogURLs(ctx, len(params), strict)
+	if err != nil && strict {
+		return nil, err
+	}
+
+	withURLs := make([]CreateUserParams, len(params))
+	for i := range params {
+		withURLs[i] = params[i]
+		withURLs[i].DogPhotoURL = urls[i]
+	}
+
+	var created []User
+
+	err = s.WithinTx(ctx, func(repo Repository) error {
+		var err error
+		created, err = repo.CreateBulk(ctx, withURLs)
+
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	return s.enrichWithDogURL(ctx, created)
+	results := make([]BatchResult, len(created))
+	for i := range created {
+		results[i] = BatchResult{User: &created[i], Warning: urlErrs[i]}
+		audit(ctx, AuditCreate, created[i].ID)
+	}
+
+	return results, nil
+}
+
+// createUsersBestEffort inserts the users one by one rather than with Repository.CreateBulk: a bulk insert fails as a
+// whole on the first conflicting row, without telling which one, while each item needs its own result.
+func (s *Service) createUsersBestEffort(ctx context.Context, params []CreateUserParams) []BatchResult {
+	results := make([]BatchResult, len(params))
+	urls, urlErrs, _ := s.parallelGetDogURLs(ctx, len(params), false)
+
+	for i := range params {
+		if urlErrs[i] != nil && s.Enrichment.Mode != EnrichDegrade {
+			results[i].Err = urlErrs[i]
+			continue
+		}
+
+		withURL := params[i]
+		withURL.DogPhotoURL = urls[i]
+
+		results[i].User, results[i].Err = s.UserRepository.Create(ctx, &withURL)
+		if results[i].Err == nil {
+			results[i].Warning = urlErrs[i]
+			audit(ctx, AuditCreate, results[i].User.ID)
+		}
+	}
+
+	return results
 }
 
+// UpdateUser changes the set fields of a user. An update without fields changes nothing, not even the version, so that
+// the ETag of the user stays valid for the other clients.
 func (s *Service) UpdateUser(ctx context.Context, u *UpdateUserParams) (*User, error) {
+	if u.Username == nil && u.Email == nil && u.DogPhotoURL == nil {
+		current, err := s.UserRepository.GetByID(ctx, u.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		if u.Version != 0 && current.Version != u.Version {
+			return nil, fmt.Errorf("%w: user %d", ErrVersionMismatch, u.ID)
+		}
+
+		return current, nil
+	}
+
 	updated, err := s.UserRepository.Update(ctx, u)
 	if err != nil {
 		return nil, err
 	}
 
-	return s.enrichWithDogURL(ctx, updated)
+	audit(ctx, AuditUpdate, u.ID)
+
+	return updated, nil
+}
+
+// RefreshDogPhoto replaces the dog photo of a user with a new random one.
+func (s *Service) RefreshDogPhoto(ctx context.Context, id int) (*User, error) {
+	url, err := s.DogClient.GetRandomDogURL(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshed, err := s.UserRepository.Update(ctx, &UpdateUserParams{ID: id, DogPhotoURL: &url})
+	if err != nil {
+		return nil, err
+	}
+
+	audit(ctx, AuditRefreshDogPhoto, id)
+
+	return refreshed, nil
 }
 
 func (s *Service) DeleteUserByID(ctx context.Context, id int) error {
-	return s.UserRepository.DeleteByID(ctx, id)
+	if err := s.UserRepository.DeleteByID(ctx, id); err != nil {
+		return err
+	}
+
+	audit(ctx, AuditDelete, id)
+
+	return nil
 }
 
-func (s *Service) enrichWithDogURL(ctx context.Context, user *User) (*User, error) {
-	url, err := s.DogClient.GetRandomDogURL(ctx)
+func (s *Service) RestoreUserByID(ctx context.Context, id int) (*User, error) {
+	restored, err := s.UserRepository.RestoreByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 
-	user.DogPhotoURL = url
+	audit(ctx, AuditRestore, id)
 
-	return user, err
+	return restored, nil
 }
 
-func (s *Service) parallelEnrichWithDogUrls(ctx context.Context, users []User) ([]User, error) {
-	g, groupCtx := errgroup.WithContext(ctx)
-	urlsCh := make(chan struct {
-		pos int
-		url string
-	})
+func (s *Service) PurgeUserByID(ctx context.Context, id int) error {
+	if err := s.UserRepository.PurgeByID(ctx, id); err != nil {
+		return err
+	}
 
-	resultCh := make(chan []User)
-	go func() {
-		defer close(resultCh)
+	audit(ctx, AuditPurge, id)
 
-		for v := range urlsCh {
-			users[v.pos].DogPhotoURL = v.url
-		}
+	return nil
+}
 
-		resultCh <- users
-	}()
+// PageLimit returns the requested page size, falling back to DefaultPageLimit and capped at MaxPageLimit.
+func (f *FindAllFilter) PageLimit() int {
+	switch {
+	case f == nil || f.Limit <= 0:
+		return DefaultPageLimit
+	case f.Limit > MaxPageLimit:
+		return MaxPageLimit
+	default:
+		return f.Limit
+	}
+}
 
-	for i := range users {
-		iCpy := i
+// parallelGetDogURLs fetches n random dog photos, at most EnrichmentConfig.MaxConcurrency at a time, and returns the
+// error of each fetch next to its URL, as well as the first error. With failFast, the first failure cancels the
+// fetches that are left.
+func (s *Service) parallelGetDogURLs(ctx context.Context, n int, failFast bool) ([]string, []error, error) {
+	urls, errs := make([]string, n), make([]error, n)
 
-		g.Go(func() error {
-			url, err := s.DogClient.GetRandomDogURL(groupCtx)
-			if err != nil {
-				return err
-			}
+	var (
+		g        = &errgroup.Group{}
+		groupCtx = ctx
+	)
 
-			urlsCh <- struct {
-				pos int
-				url string
-			}{pos: iCpy, url: url}
+	if failFast {
+		g, groupCtx = errgroup.WithContext(ctx)
+	}
 
-			return nil
-		})
+	limit := s.Enrichment.MaxConcurrency
+	if limit <= 0 {
+		limit = DefaultEnrichmentConcurrency
 	}
 
-	err := g.Wait()
-	close(urlsCh) //nolint:wsl // special case
+	g.SetLimit(limit)
 
-	if err != nil { //nolint:wsl,nolintlint
-		return nil, err
+	for i := range urls {
+		iCpy := i
+
+		g.Go(func() error {
+			urls[iCpy], errs[iCpy] = s.DogClient.GetRandomDogURL(groupCtx)
+			return errs[iCpy]
+		})
 	}
 
-	return <-resultCh, nil
+	err := g.Wait()
+
+	return urls, errs, err
 }